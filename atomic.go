@@ -0,0 +1,113 @@
+package ftp
+
+import (
+	"fmt"
+	"io"
+	"net/textproto"
+	"path"
+)
+
+// TempNameFunc returns the temporary name under which StorAtomic uploads
+// the file at path.
+type TempNameFunc func(path string) string
+
+// TempSuffix returns a TempNameFunc which appends suffix to the name, such
+// as "report.csv.part" for TempSuffix(".part").
+func TempSuffix(suffix string) TempNameFunc {
+	return func(name string) string {
+		return name + suffix
+	}
+}
+
+// TempPrefix returns a TempNameFunc which prepends prefix to the base name,
+// such as "dir/.report.csv" for TempPrefix(".").
+func TempPrefix(prefix string) TempNameFunc {
+	return func(name string) string {
+		dir, base := path.Split(name)
+		return dir + prefix + base
+	}
+}
+
+// DefaultTempName is used by StorAtomic when no TempNameFunc is given.
+var DefaultTempName = TempSuffix(".part")
+
+// Uploads a file to the remote FTP server without ever exposing a partial
+// file under its final name. The data is stored under the temporary name
+// given by tempName, or DefaultTempName if it is nil, in binary mode; its
+// size is checked once the upload is done, then it is renamed into place.
+// If the server refuses to rename over an existing file, that file is
+// deleted and the rename tried again. The temporary file is removed on
+// failure, unless the existing file was deleted already: the data is then
+// kept under the temporary name, which the error names.
+func (c *ServerConn) StorAtomic(path string, r io.Reader, tempName TempNameFunc) error {
+	if tempName == nil {
+		tempName = DefaultTempName
+	}
+	tmp := tempName(path)
+	// the size is checked against the bytes read, which ASCII mode would
+	// not keep
+	if err := c.binary(); err != nil {
+		return err
+	}
+
+	cr := &countingReader{r: r}
+	err := c.Stor(tmp, cr)
+	if err == nil {
+		err = c.checkSize(tmp, cr.n)
+	}
+	if err == nil {
+		err = c.Rename(tmp, path)
+		if err != nil && c.isTargetExists(err, path) {
+			// some servers do not rename over an existing file
+			if c.Delete(path) == nil {
+				if err = c.Rename(tmp, path); err != nil {
+					return fmt.Errorf("ftp: %s was deleted, but %s could not be renamed to it: %w", path, tmp, err)
+				}
+			}
+		}
+	}
+	if err != nil {
+		c.Delete(tmp)
+	}
+	return err
+}
+
+// isTargetExists reports whether err, the refusal of a rename to path, is
+// that of a server which does not rename over an existing file: a 550 or
+// 553 reply, for a path which is a file.
+func (c *ServerConn) isTargetExists(err error, path string) bool {
+	te, ok := err.(*textproto.Error)
+	if !ok || (te.Code != StatusFileUnavailable && te.Code != StatusBadFileName) {
+		return false
+	}
+	fi, err := c.Stat(path)
+	return err == nil && !fi.IsDir()
+}
+
+// checkSize checks that the size of the remote file at path is size.
+func (c *ServerConn) checkSize(path string, size int64) error {
+	n, err := c.FileSize(path)
+	if err != nil {
+		fi, err := c.Stat(path)
+		if err != nil {
+			return err
+		}
+		n = fi.Size()
+	}
+	if n != size {
+		return fmt.Errorf("ftp: %s has %d bytes after uploading %d", path, n, size)
+	}
+	return nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(buf []byte) (int, error) {
+	n, err := cr.r.Read(buf)
+	cr.n += int64(n)
+	return n, err
+}
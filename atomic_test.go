@@ -0,0 +1,91 @@
+package ftp
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStorAtomic(t *testing.T) {
+	s := newTestServer(t, map[string]string{"/pub/report.csv": "old"})
+	c := s.conn()
+
+	for _, tempName := range []TempNameFunc{nil, TempPrefix(".")} {
+		if err := c.StorAtomic("/pub/report.csv", strings.NewReader("new data"), tempName); err != nil {
+			t.Fatal(err)
+		}
+		if f := s.file("/pub/report.csv"); f == nil || string(f.data) != "new data" {
+			t.Error("report.csv was not replaced")
+		}
+		s.mu.Lock()
+		s.files["/pub/report.csv"].data = []byte("old")
+		s.mu.Unlock()
+	}
+
+	if got := TempPrefix(".")("/pub/report.csv"); got != "/pub/.report.csv" {
+		t.Errorf("TempPrefix = %s", got)
+	}
+
+	// a failed upload leaves neither the temporary nor the final file
+	err := c.StorAtomic("/pub/new.csv", &failingReader{}, nil)
+	if err == nil {
+		t.Error("expected an error")
+	}
+	for _, name := range []string{"/pub/new.csv", "/pub/new.csv.part"} {
+		if s.file(name) != nil {
+			t.Errorf("%s exists after a failed upload", name)
+		}
+	}
+	if err = c.NoOp(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStorAtomicRename(t *testing.T) {
+	s := newTestServer(t, map[string]string{"/pub/report.csv": "old"})
+	s.keep = true
+	c := s.conn()
+
+	// a server which does not rename over a file has it deleted first
+	if err := c.StorAtomic("/pub/report.csv", strings.NewReader("new"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if f := s.file("/pub/report.csv"); f == nil || string(f.data) != "new" {
+		t.Error("report.csv was not replaced")
+	}
+
+	// any other refusal leaves the file alone
+	s.rnto = StatusActionAborted
+	if err := c.StorAtomic("/pub/report.csv", strings.NewReader("newer"), nil); err == nil {
+		t.Error("expected an error")
+	}
+	if f := s.file("/pub/report.csv"); f == nil || string(f.data) != "new" {
+		t.Error("report.csv was changed after a failed rename")
+	}
+	if s.file("/pub/report.csv.part") != nil {
+		t.Error("the temporary file was left after a failed rename")
+	}
+
+	// once the file is deleted, the data is kept under the temporary name
+	s.rnto = StatusFileUnavailable
+	err := c.StorAtomic("/pub/report.csv", strings.NewReader("newest"), nil)
+	if err == nil || !strings.Contains(err.Error(), "report.csv.part") {
+		t.Errorf("StorAtomic = %v, want an error naming the temporary file", err)
+	}
+	if f := s.file("/pub/report.csv.part"); f == nil || string(f.data) != "newest" {
+		t.Error("the data was lost with the file it replaces")
+	}
+}
+
+// failingReader returns some data, then an error.
+type failingReader struct {
+	done bool
+}
+
+func (r *failingReader) Read(buf []byte) (int, error) {
+	if r.done {
+		return 0, errors.New("read failed")
+	}
+	r.done = true
+	return copy(buf, "partial"), nil
+}
@@ -0,0 +1,143 @@
+package ftp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/textproto"
+)
+
+/*
+Charset transcodes the filenames exchanged with a server which does not
+use UTF-8, such as an old Windows server with Latin-1 names. Encode turns
+a UTF-8 string into the encoding of the server, and Decode does the
+opposite.
+
+An encoding of golang.org/x/text can be adapted with its encoder and
+decoder:
+
+	type xCharset struct{ e encoding.Encoding }
+
+	func (cs xCharset) Encode(s string) (string, error) { return cs.e.NewEncoder().String(s) }
+	func (cs xCharset) Decode(s string) (string, error) { return cs.e.NewDecoder().String(s) }
+
+The encoding must keep the ASCII characters as they are, as the commands
+and the listings are made of them.
+*/
+type Charset interface {
+	Encode(s string) (string, error)
+	Decode(s string) (string, error)
+}
+
+// Latin1 is the ISO 8859-1 Charset, in which every byte is the character
+// of the same code.
+var Latin1 Charset = latin1{}
+
+type latin1 struct{}
+
+func (latin1) Encode(s string) (string, error) {
+	buf := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return "", fmt.Errorf("ftp: %q cannot be encoded in Latin-1", s)
+		}
+		buf = append(buf, byte(r))
+	}
+	return string(buf), nil
+}
+
+func (latin1) Decode(s string) (string, error) {
+	runes := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		runes[i] = rune(s[i])
+	}
+	return string(runes), nil
+}
+
+// Sets the charset of the filenames of the server, in which the paths
+// given to the commands are encoded and the listings decoded. If the
+// server advertises UTF8 in reply to FEAT, it is asked to use UTF-8 with
+// OPTS UTF8 ON instead, and nothing is transcoded; cs is only used if it
+// refuses. A nil cs turns the transcoding off.
+func (c *ServerConn) SetCharset(cs Charset) error {
+	c.charset = nil
+	if cs == nil {
+		return nil
+	}
+	if c.hasFeature("UTF8") {
+		_, _, err := c.cmd(StatusCommandOK, "OPTS UTF8 ON")
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(*textproto.Error); !ok {
+			return err
+		}
+		c.trace.event("OPTS UTF8 ON refused, transcoding: %v", err)
+	}
+	c.charset = cs
+	return nil
+}
+
+// encodeArgs encodes the string arguments of a command in the charset of
+// the server.
+func (c *ServerConn) encodeArgs(args []interface{}) ([]interface{}, error) {
+	if c.charset == nil {
+		return args, nil
+	}
+	encoded := make([]interface{}, len(args))
+	for i, arg := range args {
+		if s, ok := arg.(string); ok {
+			e, err := c.charset.Encode(s)
+			if err != nil {
+				return nil, err
+			}
+			arg = e
+		}
+		encoded[i] = arg
+	}
+	return encoded, nil
+}
+
+// decode decodes a reply of the server, such as the path of PWD. It is
+// kept as it is if it cannot be decoded.
+func (c *ServerConn) decode(s string) string {
+	if c.charset == nil {
+		return s
+	}
+	if d, err := c.charset.Decode(s); err == nil {
+		return d
+	}
+	return s
+}
+
+// decodeReader decodes the lines of a listing read from r.
+func (c *ServerConn) decodeReader(r io.Reader) io.Reader {
+	if c.charset == nil {
+		return r
+	}
+	return &lineDecoder{c: c, r: bufio.NewReader(r)}
+}
+
+// lineDecoder decodes a listing line by line, so that no character is
+// split between two reads. A line which cannot be decoded is kept as it
+// is, to be reported by the parser if need be.
+type lineDecoder struct {
+	c   *ServerConn
+	r   *bufio.Reader
+	buf []byte
+	err error
+}
+
+func (d *lineDecoder) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		var line string
+		line, d.err = d.r.ReadString('\n')
+		d.buf = []byte(d.c.decode(line))
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
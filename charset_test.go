@@ -0,0 +1,129 @@
+package ftp
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLatin1(t *testing.T) {
+	e, err := Latin1.Encode("café")
+	if err != nil || e != "caf\xe9" {
+		t.Errorf("Encode = %q, %v", e, err)
+	}
+	if d, err := Latin1.Decode(e); err != nil || d != "café" {
+		t.Errorf("Decode = %q, %v", d, err)
+	}
+	if _, err := Latin1.Encode("日本"); err == nil {
+		t.Error("expected an error for characters beyond Latin-1")
+	}
+}
+
+func TestCharset(t *testing.T) {
+	s := newTestServer(t, map[string]string{"/pub/caf\xe9.txt": "menu"})
+	s.mkdirAll("/r\xe9ponses")
+	c := s.conn()
+	if err := c.SetCharset(Latin1); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.count("OPTS"); n != 0 {
+		t.Errorf("OPTS sent %d times to a server without UTF8", n)
+	}
+
+	entries, err := c.List("/pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != "café.txt" {
+		t.Fatalf("List = %v", entries)
+	}
+
+	r, err := c.Retr("/pub/café.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != "menu" {
+		t.Errorf("Retr = %q, %v", data, err)
+	}
+
+	if err = c.Stor("/pub/naïve.txt", strings.NewReader("x")); err != nil {
+		t.Fatal(err)
+	}
+	if s.file("/pub/na\xefve.txt") == nil {
+		t.Error("Stor did not encode the name in Latin-1")
+	}
+
+	if err = c.ChangeDir("/réponses"); err != nil {
+		t.Fatal(err)
+	}
+	if cwd, err := c.CurrentDir(); err != nil || cwd != "/réponses" {
+		t.Errorf("CurrentDir = %q, %v", cwd, err)
+	}
+
+	// a name which cannot be encoded is not sent, and the connection
+	// stays usable
+	if err = c.Stor("/pub/日本.txt", strings.NewReader("x")); err == nil {
+		t.Error("expected an error for a name beyond Latin-1")
+	}
+	if err = c.NoOp(); err != nil {
+		t.Error(err)
+	}
+
+	if err = c.SetCharset(nil); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ = c.List("/pub"); len(entries) == 0 || entries[0].Name != "caf\xe9.txt" {
+		t.Errorf("List without a charset = %v", entries)
+	}
+}
+
+func TestCharsetMLSD(t *testing.T) {
+	s := newTestServer(t, map[string]string{"/pub/caf\xe9.txt": "menu"})
+	s.mlsd = true
+	c := s.conn()
+	if err := c.SetCharset(Latin1); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := c.MLSD("/pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	if strings.Join(names, ",") != ".,café.txt" {
+		t.Errorf("MLSD = %v", names)
+	}
+	if fi, err := c.Stat("/pub/café.txt"); err != nil || fi.Name() != "café.txt" {
+		t.Errorf("Stat = %v, %v", fi, err)
+	}
+}
+
+func TestCharsetUTF8(t *testing.T) {
+	s := newTestServer(t, map[string]string{"/pub/café.txt": "menu"})
+	s.utf8 = true
+	c := s.conn()
+	if err := c.SetCharset(Latin1); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.count("OPTS"); n != 1 {
+		t.Errorf("OPTS sent %d times, want 1", n)
+	}
+
+	entries, err := c.List("/pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != "café.txt" {
+		t.Fatalf("List = %v", entries)
+	}
+	if err = c.Stor("/pub/日本.txt", strings.NewReader("x")); err != nil {
+		t.Fatal(err)
+	}
+	if s.file("/pub/日本.txt") == nil {
+		t.Error("Stor did not send the name in UTF-8")
+	}
+}
@@ -0,0 +1,92 @@
+package ftp
+
+import (
+	"io/fs"
+	"net/textproto"
+	"path"
+)
+
+// MakeDirAll creates a directory on the remote FTP server, along with any
+// missing parents. Directories which exist already are left alone. The
+// error, if any, is an *fs.PathError naming the directory which could not
+// be created.
+func (c *ServerConn) MakeDirAll(dir string) error {
+	dir = path.Clean(dir)
+	var parents []string
+	for p := dir; p != "." && p != "/"; p = path.Dir(p) {
+		parents = append(parents, p)
+	}
+
+	for i := len(parents) - 1; i >= 0; i-- {
+		p := parents[i]
+		err := c.MakeDir(p)
+		if err == nil {
+			continue
+		}
+		if _, ok := err.(*textproto.Error); !ok {
+			return &fs.PathError{Op: "mkdir", Path: p, Err: err}
+		}
+
+		// the reply to MKD for an existing directory varies among servers,
+		// so check whether it is there
+		isDir, err2 := c.isDir(p)
+		if err2 != nil {
+			return &fs.PathError{Op: "mkdir", Path: p, Err: err2}
+		}
+		if !isDir {
+			return &fs.PathError{Op: "mkdir", Path: p, Err: err}
+		}
+	}
+	return nil
+}
+
+// RemoveAll removes a file, or a directory and everything it contains,
+// from the remote FTP server. Files are deleted with DELE and directories
+// are removed bottom-up with RMD. Symbolic links are deleted, not followed,
+// so nothing outside of name is removed. Like os.RemoveAll, it refuses to
+// remove the root or the current directory: the error is then fs.ErrInvalid.
+// The error, if any, is an *fs.PathError naming the file or directory which
+// could not be removed.
+func (c *ServerConn) RemoveAll(name string) error {
+	if clean := path.Clean(name); clean == "/" || clean == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	name = path.Clean(name)
+	// a CWD probe would follow a link to a directory, so the entry is
+	// looked up in the listing of its parent
+	entry, err := c.lookup(name)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if !entry.isDir() {
+		if err = c.Delete(name); err != nil {
+			return &fs.PathError{Op: "remove", Path: name, Err: err}
+		}
+		return nil
+	}
+	return c.removeDir(name)
+}
+
+func (c *ServerConn) removeDir(dir string) error {
+	entries, err := c.readDir(dir)
+	if err != nil {
+		return &fs.PathError{Op: "readdir", Path: dir, Err: err}
+	}
+
+	for _, entry := range entries {
+		name := path.Join(dir, entry.Name)
+		if entry.isDir() {
+			err = c.removeDir(name)
+		} else if err = c.Delete(name); err != nil {
+			err = &fs.PathError{Op: "remove", Path: name, Err: err}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = c.RemoveDir(dir); err != nil {
+		return &fs.PathError{Op: "rmdir", Path: dir, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package ftp
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func TestMakeDirAll(t *testing.T) {
+	s := newTestServer(t, map[string]string{"/a/file": "data"})
+	c := s.conn()
+
+	if err := c.MakeDirAll("/a/b/c"); err != nil {
+		t.Fatal(err)
+	}
+	if f := s.file("/a/b/c"); f == nil || !f.dir {
+		t.Error("/a/b/c was not created")
+	}
+	if err := c.MakeDirAll("/a/b/c/"); err != nil {
+		t.Errorf("MakeDirAll on an existing directory: %v", err)
+	}
+
+	var pe *fs.PathError
+	err := c.MakeDirAll("/a/file/d")
+	if !errors.As(err, &pe) || pe.Path != "/a/file" {
+		t.Errorf("MakeDirAll below a file = %v, want an error for /a/file", err)
+	}
+}
+
+func TestRemoveAll(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"/keep":        "data",
+		"/a/file":      "data",
+		"/a/b/c/file1": "data",
+		"/a/b/c/file2": "data",
+		"/a/d/file":    "data",
+	})
+	s.mkdirAll("/a/empty")
+	c := s.conn()
+
+	if err := c.RemoveAll("/a"); err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	for name := range s.files {
+		if name != "/" && name != "/keep" {
+			t.Errorf("%s was not removed", name)
+		}
+	}
+	s.mu.Unlock()
+
+	if err := c.RemoveAll("/keep"); err != nil {
+		t.Fatal(err)
+	}
+	if s.file("/keep") != nil {
+		t.Error("/keep was not removed")
+	}
+
+	var pe *fs.PathError
+	if err := c.RemoveAll("/missing"); !errors.As(err, &pe) || pe.Path != "/missing" {
+		t.Errorf("RemoveAll of a missing file = %v, want an error for /missing", err)
+	}
+}
+
+func TestRemoveAllSymlink(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"/data/precious.txt": "data",
+		"/dir/file":          "data",
+	})
+	s.symlink("/dir/link", "/data")
+	c := s.conn()
+
+	if err := c.RemoveAll("/dir/link"); err != nil {
+		t.Fatal(err)
+	}
+	if s.file("/dir/link") != nil {
+		t.Error("/dir/link was not removed")
+	}
+	if s.file("/data/precious.txt") == nil {
+		t.Error("the target of /dir/link was removed")
+	}
+
+	// a link inside a removed directory is deleted, not followed
+	s.symlink("/dir/link", "/data")
+	if err := c.RemoveAll("/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if s.file("/dir") != nil {
+		t.Error("/dir was not removed")
+	}
+	if s.file("/data/precious.txt") == nil {
+		t.Error("the target of /dir/link was removed")
+	}
+	if n := s.count("DELE"); n != 3 {
+		t.Errorf("DELE sent %d times, want 3", n)
+	}
+}
+
+func TestRemoveAllRoot(t *testing.T) {
+	s := newTestServer(t, map[string]string{"/a/file": "data", "/keep": "data"})
+	c := s.conn()
+	if err := c.ChangeDir("/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"/", "//", ".", "./", "", "b/.."} {
+		err := c.RemoveAll(name)
+		if !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("RemoveAll(%q) = %v, want fs.ErrInvalid", name, err)
+		}
+	}
+	for _, name := range []string{"/a/file", "/keep"} {
+		if s.file(name) == nil {
+			t.Errorf("%s was removed", name)
+		}
+	}
+	if n := s.count("DELE") + s.count("RMD"); n != 0 {
+		t.Errorf("%d DELE and RMD sent", n)
+	}
+}
@@ -0,0 +1,184 @@
+package ftp
+
+import (
+	"errors"
+	"io"
+	"net/textproto"
+	"sync"
+)
+
+// DialFunc returns a new connection to the server, already logged in.
+type DialFunc func() (*ServerConn, error)
+
+// Default values for a Downloader.
+const (
+	DefaultSegments       = 4
+	DefaultMinSegmentSize = 1 << 20
+)
+
+var errRestUnsupported = errors.New("REST is not supported by the server")
+
+/*
+Downloader fetches a single remote file through several connections at
+once. The file is split into byte ranges, each range is requested with
+REST+RETR on its own connection and written at its offset into an
+io.WriterAt. Servers which do not support REST are read through a single
+stream instead. The connections are switched to binary mode with TYPE I,
+as the sizes and offsets of ASCII mode are not byte counts.
+*/
+type Downloader struct {
+	// Dial opens the connections used for the segments. Each connection
+	// is closed when its segment is done.
+	Dial DialFunc
+
+	// Segments is the number of ranges fetched in parallel.
+	// DefaultSegments is used when it is 0.
+	Segments int
+
+	// MinSegmentSize is the smallest range worth its own connection.
+	// DefaultMinSegmentSize is used when it is 0.
+	MinSegmentSize int64
+}
+
+// Download fetches the remote file at path into w and returns the number
+// of bytes written.
+func (d *Downloader) Download(path string, w io.WriterAt) (int64, error) {
+	c, err := d.Dial()
+	if err != nil {
+		return 0, err
+	}
+	if err = c.binary(); err != nil {
+		c.Quit()
+		return 0, err
+	}
+
+	size, err := c.FileSize(path)
+	if err != nil || !c.hasFeature("REST") {
+		defer c.Quit()
+		return d.single(c, path, w)
+	}
+
+	segments := d.Segments
+	if segments <= 0 {
+		segments = DefaultSegments
+	}
+	minSize := d.MinSegmentSize
+	if minSize <= 0 {
+		minSize = DefaultMinSegmentSize
+	}
+	if n := size / minSize; n < int64(segments) {
+		segments = int(n)
+	}
+	if segments <= 1 {
+		defer c.Quit()
+		return d.single(c, path, w)
+	}
+
+	step := size / int64(segments)
+	errs := make([]error, segments)
+	var wg sync.WaitGroup
+	for i := 0; i < segments; i++ {
+		offset := int64(i) * step
+		length := step
+		if i == segments-1 {
+			length = size - offset
+		}
+
+		conn := c
+		if i > 0 {
+			conn = nil
+		}
+		wg.Add(1)
+		go func(i int, conn *ServerConn, offset, length int64) {
+			defer wg.Done()
+			if conn == nil {
+				var err error
+				conn, err = d.Dial()
+				if err != nil {
+					errs[i] = err
+					return
+				}
+			}
+			defer conn.Quit()
+			errs[i] = fetchSegment(conn, path, w, offset, length)
+		}(i, conn, offset, length)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == errRestUnsupported {
+			return d.fallback(path, w)
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return 0, err
+		}
+	}
+	return size, nil
+}
+
+// fallback fetches the whole file through a new connection.
+func (d *Downloader) fallback(path string, w io.WriterAt) (int64, error) {
+	c, err := d.Dial()
+	if err != nil {
+		return 0, err
+	}
+	defer c.Quit()
+	return d.single(c, path, w)
+}
+
+// single fetches the whole file through one stream.
+func (d *Downloader) single(c *ServerConn, path string, w io.WriterAt) (int64, error) {
+	if err := c.binary(); err != nil {
+		return 0, err
+	}
+	r, err := c.Retr(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(io.NewOffsetWriter(w, 0), r)
+	if err2 := r.Close(); err == nil {
+		err = err2
+	}
+	return n, err
+}
+
+// fetchSegment reads length bytes of the remote file from offset, writes
+// them into w, and closes the data connection as soon as they are read.
+func fetchSegment(c *ServerConn, path string, w io.WriterAt, offset, length int64) error {
+	if err := c.binary(); err != nil {
+		return err
+	}
+	if offset > 0 {
+		_, _, err := c.cmd(StatusRequestFilePending, "REST %d", offset)
+		if e, ok := err.(*textproto.Error); ok && e.Code >= 500 {
+			return errRestUnsupported
+		} else if err != nil {
+			return err
+		}
+	}
+
+	r, err := c.Retr(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(io.NewOffsetWriter(w, offset), r, length)
+	r.Close()
+	return err
+}
+
+// binary switches the connection to binary mode with TYPE I, once, for
+// the transfers whose sizes and offsets must be byte counts. ASCII mode is
+// the default of RFC 959.
+func (c *ServerConn) binary() error {
+	if c.binaryMode {
+		return nil
+	}
+	if _, _, err := c.cmd(StatusCommandOK, "TYPE I"); err != nil {
+		return err
+	}
+	c.binaryMode = true
+	return nil
+}
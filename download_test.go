@@ -0,0 +1,130 @@
+package ftp
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloader(t *testing.T) {
+	data := strings.Repeat("0123456789abcdef", 1000)
+	for _, noRest := range []bool{false, true} {
+		s := newTestServer(t, map[string]string{"/big.bin": data})
+		s.noRest = noRest
+
+		f, err := os.Create(filepath.Join(t.TempDir(), "big.bin"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := &Downloader{Dial: s.dial, Segments: 3, MinSegmentSize: 1000}
+		n, err := d.Download("/big.bin", f)
+		if err != nil {
+			t.Fatalf("noRest=%v: %v", noRest, err)
+		}
+		if n != int64(len(data)) {
+			t.Errorf("noRest=%v: downloaded %d bytes, want %d", noRest, n, len(data))
+		}
+
+		got, err := os.ReadFile(f.Name())
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, []byte(data)) {
+			t.Errorf("noRest=%v: downloaded data differs", noRest)
+		}
+	}
+}
+
+func TestRetrFromClose(t *testing.T) {
+	s := newTestServer(t, map[string]string{"/file": "Just some text"})
+	c := s.conn()
+
+	r, err := c.RetrFrom("/file", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err = r.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "some" {
+		t.Errorf("read '%s', want 'some'", buf)
+	}
+	r.Close()
+
+	// the control connection must be usable after closing early
+	if err = c.NoOp(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFeaturesRefused(t *testing.T) {
+	s := newTestServer(t, map[string]string{"/pub/a.txt": "a"})
+	s.noFeat = true
+	c := s.conn()
+
+	if _, err := c.Features(); err == nil {
+		t.Error("expected the refusal of FEAT")
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := c.Stat("/pub/a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.readDir("/pub"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := s.count("FEAT"); n != 1 {
+		t.Errorf("FEAT sent %d times, want 1", n)
+	}
+}
+
+func TestBinaryMode(t *testing.T) {
+	data := strings.Repeat("0123456789abcdef", 1000)
+	s := newTestServer(t, map[string]string{"/big.bin": data})
+	s.ascii = true
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "big.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := &Downloader{Dial: s.dial, Segments: 3, MinSegmentSize: 1000}
+	if _, err = d.Download("/big.bin", f); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(f.Name()); err != nil || string(got) != data {
+		t.Errorf("downloaded data differs: %v", err)
+	}
+	if n := s.count("REST"); n != 2 {
+		t.Errorf("REST sent %d times, want 2 for the segments", n)
+	}
+	if n := s.count("TYPE"); n != 3 {
+		t.Errorf("TYPE sent %d times, want 3 for the connections", n)
+	}
+
+	c := s.conn()
+	rf, err := c.OpenFile("/big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rf.Size() != int64(len(data)) {
+		t.Errorf("OpenFile size = %d", rf.Size())
+	}
+	buf := make([]byte, 4)
+	if _, err = rf.ReadAt(buf, 16); err != nil || string(buf) != "0123" {
+		t.Errorf("ReadAt = %q, %v", buf, err)
+	}
+	rf.Close()
+
+	if err = c.StorAtomic("/copy.bin", strings.NewReader(data), nil); err != nil {
+		t.Fatal(err)
+	}
+	// the mode is set once per connection
+	if n := s.count("TYPE"); n != 4 {
+		t.Errorf("TYPE sent %d times, want 4", n)
+	}
+}
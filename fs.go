@@ -0,0 +1,218 @@
+package ftp
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/textproto"
+	"path"
+	"sort"
+	"time"
+)
+
+/*
+FS presents a directory of the remote server as an fs.FS. It also
+implements fs.ReadDirFS, fs.StatFS and fs.ReadFileFS.
+
+Files are read with RETR and directories are listed with MLSD or LIST.
+Entries are looked up in the listing of their parent directory, so Stat
+and ReadDir always agree on the details of a file.
+
+As the underlying ServerConn, an FS must not be used concurrently, and
+only one opened file can be read at a time.
+*/
+type FS struct {
+	c    *ServerConn
+	root string
+}
+
+// NewFS returns an FS for the directory root of the server.
+func NewFS(c *ServerConn, root string) *FS {
+	return &FS{c: c, root: root}
+}
+
+func (f *FS) path(name string) string {
+	return path.Join(f.root, name)
+}
+
+// Open opens the named file, or directory.
+func (f *FS) Open(name string) (fs.File, error) {
+	info, err := f.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return &file{fsys: f, name: name, info: info}, nil
+	}
+
+	entries, err := f.readDir("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &dirFile{info: info, entries: entries}, nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by name.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	info, err := f.stat("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return f.readDir("readdir", name)
+}
+
+// Stat returns a FileInfo describing the named file. Its Sys method returns
+// the *FTPListData of the file.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	return f.stat("stat", name)
+}
+
+// ReadFile reads the named file and returns its contents.
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	r, err := f.c.Retr(f.path(name))
+	if err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+	data, err := io.ReadAll(r)
+	if err2 := r.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+	return data, nil
+}
+
+func (f *FS) stat(op, name string) (*fileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		entry := newFTPListData("")
+		entry.Name = "."
+		entry.TryCwd = true
+		return &fileInfo{entry}, nil
+	}
+
+	entry, err := f.c.lookup(f.path(name))
+	if err != nil {
+		return nil, pathError(op, name, err)
+	}
+	return &fileInfo{entry}, nil
+}
+
+func (f *FS) readDir(op, name string) ([]fs.DirEntry, error) {
+	list, err := f.c.readDir(f.path(name))
+	if err != nil {
+		return nil, pathError(op, name, err)
+	}
+	entries := make([]fs.DirEntry, len(list))
+	for i, entry := range list {
+		entries[i] = &fileInfo{entry}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// pathError wraps an error of the server in an *fs.PathError. A reply
+// 550 (file unavailable) is reported as fs.ErrNotExist.
+func pathError(op, name string, err error) error {
+	if e, ok := err.(*textproto.Error); ok && e.Code == StatusFileUnavailable {
+		err = fs.ErrNotExist
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// fileInfo implements fs.FileInfo and fs.DirEntry for a listing entry.
+type fileInfo struct {
+	entry *FTPListData
+}
+
+func (fi *fileInfo) Name() string       { return fi.entry.Name }
+func (fi *fileInfo) Size() int64        { return int64(fi.entry.Size) }
+func (fi *fileInfo) ModTime() time.Time { return fi.entry.Mtime }
+func (fi *fileInfo) IsDir() bool        { return fi.Mode().IsDir() }
+func (fi *fileInfo) Sys() interface{}   { return fi.entry }
+
+// Mode returns the mode shown by the listing if any. Otherwise it is
+// guessed from the kind of the entry.
+func (fi *fileInfo) Mode() fs.FileMode {
+	if fi.entry.Mode != 0 {
+		return fi.entry.Mode
+	}
+	switch {
+	case fi.entry.isLink():
+		return fs.ModeSymlink | 0777
+	case fi.entry.isDir():
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (fi *fileInfo) Type() fs.FileMode          { return fi.Mode().Type() }
+func (fi *fileInfo) Info() (fs.FileInfo, error) { return fi, nil }
+
+// file is a regular file opened from an FS. The transfer starts on the
+// first read.
+type file struct {
+	fsys *FS
+	name string
+	info *fileInfo
+	r    io.ReadCloser
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *file) Read(buf []byte) (int, error) {
+	if f.r == nil {
+		r, err := f.fsys.c.Retr(f.fsys.path(f.name))
+		if err != nil {
+			return 0, pathError("read", f.name, err)
+		}
+		f.r = r
+	}
+	return f.r.Read(buf)
+}
+
+func (f *file) Close() error {
+	if f.r == nil {
+		return nil
+	}
+	err := f.r.Close()
+	f.r = nil
+	return err
+}
+
+// dirFile is a directory opened from an FS. Its entries are listed when
+// it is opened.
+type dirFile struct {
+	info    *fileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *dirFile) Read(buf []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+func (d *dirFile) Close() error { return nil }
+
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries := d.entries[d.offset:]
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(entries) {
+		entries = entries[:n]
+	}
+	d.offset += len(entries)
+	return entries, nil
+}
@@ -0,0 +1,23 @@
+package ftp
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	for _, mlsd := range []bool{false, true} {
+		s := newTestServer(t, map[string]string{
+			"/pub/hello.txt":        "hello, world\n",
+			"/pub/empty":            "",
+			"/pub/docs/readme.md":   "# readme\n",
+			"/pub/docs/a/b/deep.go": "package deep\n",
+		})
+		s.mlsd = mlsd
+		fsys := NewFS(s.conn(), "/pub")
+
+		if err := fstest.TestFS(fsys, "hello.txt", "empty", "docs/readme.md", "docs/a/b/deep.go"); err != nil {
+			t.Errorf("mlsd=%v: %v", mlsd, err)
+		}
+	}
+}
@@ -27,31 +27,58 @@ import (
 	"net/textproto"
 	"strconv"
 	"strings"
-	// "time"
+	"time"
 )
 
 type ServerConn struct {
-	conn *textproto.Conn
-	host string
+	conn     *textproto.Conn
+	host     string
+	features map[string]string
+	featErr  error
+	progress ProgressFunc
+	limiters []*Limiter
+	trace    *tracer
+	observer Observer
+	parser   *Parser
+
+	syst       string
+	systErr    error
+	listFormat LIST_FORMAT // format of the listings of the session, once known
+	charset    Charset     // charset of the filenames, nil for UTF-8
+	binaryMode bool        // TYPE I was sent
 }
 
 type response struct {
-	conn net.Conn
-	c    *ServerConn
+	conn     net.Conn
+	c        *ServerConn
+	done     bool // the final reply has been read
+	progress *progress
+
+	verb  string    // command of the transfer
+	start time.Time // start of the transfer
+	n     int64     // bytes read
 }
 
 // Connect to a ftp server and returns a ServerConn handler.
 func Connect(addr string) (*ServerConn, error) {
+	return ConnectTrace(addr, nil)
+}
+
+// Connect to a ftp server, with a transcript of the protocol written to w
+// from the greeting of the server on. See SetTrace.
+func ConnectTrace(addr string, w io.Writer) (*ServerConn, error) {
 	if strings.Contains(addr, ":") == false {
 		addr = addr + ":21"
 	}
-	conn, err := textproto.Dial("tcp", addr)
+	nc, err := net.Dial("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
+	t := &tracer{w: w}
+	conn := textproto.NewConn(&traceConn{Conn: nc, t: t})
 
 	a := strings.SplitN(addr, ":", 2)
-	c := &ServerConn{conn, a[0]}
+	c := &ServerConn{conn: conn, host: a[0], trace: t}
 
 	// _, _, err = c.conn.ReadCodeLine(StatusReady)
 	_, _, err = MyReadCodeLine(c.conn, StatusReady)
@@ -87,12 +114,10 @@ func MyReadCodeLine(r *textproto.Conn, expectCode int) (code int, message string
 }
 func MyreadCodeLine(r *textproto.Conn, expectCode int) (code int, continued bool, message string, err error) {
 	var line string
-	//fmt.Print("read ")
 	line, err = r.ReadLine()
 	if err != nil {
 		return
 	}
-	//fmt.Println(line)
 	// for (    Used disk quota 0 Kbytes, available 1000000 Kbytes)
 	if strings.HasPrefix(line, "  ") {
 		line, _ = r.ReadLine()
@@ -100,12 +125,10 @@ func MyreadCodeLine(r *textproto.Conn, expectCode int) (code int, continued bool
 			return
 		}
 
-		//fmt.Printf("1: %s\n", line)
 		line, err = r.ReadLine()
 		if err != nil {
 			return
 		}
-		//fmt.Printf("2: %s\n", line)
 	}
 
 	code, continued, message, err = parseCodeLine(line, expectCode)
@@ -189,17 +212,30 @@ func (c *ServerConn) openDataConn() (net.Conn, error) {
 	if err != nil {
 		return nil, err
 	}
+	if c.trace.enabled() {
+		c.trace.event("data open %s", addr)
+		conn = &traceDataConn{Conn: conn, t: c.trace}
+	}
+	if len(c.limiters) > 0 {
+		return newLimitedConn(conn, c.limiters), nil
+	}
 	return conn, nil
 }
 
 // Helper function to execute a command and check for the expected code
-func (c *ServerConn) cmd(expected int, format string, args ...interface{}) (int, string, error) {
-	_, err := c.conn.Cmd(format, args...)
+func (c *ServerConn) cmd(expected int, format string, args ...interface{}) (code int, line string, err error) {
+	if c.observer != nil {
+		defer c.observeCmd(EventCommand, format, time.Now(), &code, &err)
+	}
+	if args, err = c.encodeArgs(args); err != nil {
+		return 0, "", err
+	}
+	_, err = c.conn.Cmd(format, args...)
 	if err != nil {
 		return 0, "", err
 	}
 	// code, line, err := c.conn.ReadCodeLine(expected)
-	code, line, err := MyReadCodeLine(c.conn, expected)
+	code, line, err = MyReadCodeLine(c.conn, expected)
 	for code == StatusLoggedIn && expected == StatusPathCreated {
 		//code, line, err = c.conn.ReadCodeLine(expected)
 		code, line, err = MyReadCodeLine(c.conn, expected)
@@ -207,74 +243,219 @@ func (c *ServerConn) cmd(expected int, format string, args ...interface{}) (int,
 	return code, line, err
 }
 
-// Helper function to execute commands which require a data connection
-func (c *ServerConn) cmdDataConn(format string, args ...interface{}) (net.Conn, error) {
+// Helper function to execute a command whose reply may span several lines,
+// such as FEAT or MLST. The lines of the reply are joined with "\n".
+func (c *ServerConn) cmdLines(expected int, format string, args ...interface{}) (code int, msg string, err error) {
+	if c.observer != nil {
+		defer c.observeCmd(EventCommand, format, time.Now(), &code, &err)
+	}
+	if args, err = c.encodeArgs(args); err != nil {
+		return 0, "", err
+	}
+	_, err = c.conn.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	return c.conn.ReadResponse(expected)
+}
+
+// Helper function to execute commands which require a data connection.
+// It also returns the message of the preliminary reply.
+func (c *ServerConn) cmdDataConn(format string, args ...interface{}) (net.Conn, string, error) {
+	var code int
+	var err error
+	if c.observer != nil {
+		defer c.observeCmd(EventDataCommand, format, time.Now(), &code, &err)
+	}
+
+	args, err = c.encodeArgs(args)
+	if err != nil {
+		return nil, "", err
+	}
 	conn, err := c.openDataConn()
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	_, err = c.conn.Cmd(format, args...)
 	if err != nil {
 		conn.Close()
-		return nil, err
+		return nil, "", err
 	}
 
 	// code, msg, err := c.conn.ReadCodeLine(-1)
 	code, msg, err := MyReadCodeLine(c.conn, -1)
 	if err != nil {
 		conn.Close()
-		return nil, err
+		return nil, "", err
 	}
 	if code != StatusAlreadyOpen && code != StatusAboutToSend && code != StatusPassiveMode {
 		conn.Close()
-		return nil, &textproto.Error{code, msg}
+		err = &textproto.Error{code, msg}
+		return nil, "", err
 	}
 
-	return conn, nil
+	return conn, msg, nil
 }
 
+// Lists a directory with the LIST command. The lines of the listing which
+// are not entries, such as "total 42", are left out. If other lines could
+// not be parsed, the entries of the rest are returned with a *ListingError.
+// If the transfer fails, the entries read so far are returned with its
+// error.
 func (c *ServerConn) List(path string) (entries []*FTPListData, err error) {
-	// fmt.Printf("\n\nstart list %s\n", path)
-	conn, err := c.cmdDataConn("LIST %s", path)
-	// fmt.Printf("list %s\n", path)
+	// SYST is sent before the data connection is opened, as its reply
+	// would be mixed up with that of LIST
+	p, hint := c.listParser(), AUTO_LIST_FORMAT
+	if p.Format == AUTO_LIST_FORMAT {
+		if c.listFormat != AUTO_LIST_FORMAT {
+			session := *p
+			session.Format = c.listFormat
+			p = &session
+		} else if syst, err := c.Syst(); err == nil {
+			hint = systFormat(syst)
+		}
+	}
+
+	conn, _, err := c.cmdDataConn("LIST %s", path)
 	if err != nil {
 		return
 	}
-	r := &response{conn, c}
+	r := c.newResponse(conn, "LIST")
 
-	bio := bufio.NewReader(r)
+	// a failed transfer, such as one ended by a 426, is reported with the
+	// entries read so far
+	entries, format, bad, err := p.parseListing(c.decodeReader(r), hint)
+	if c.listParser().Format == AUTO_LIST_FORMAT && c.listFormat == AUTO_LIST_FORMAT {
+		c.listFormat = format
+	}
+	if err == nil && len(bad) > 0 {
+		err = &ListingError{Lines: bad}
+	}
 
-	//fmt.Println("start listLine")
+	defer func() {
+		err := r.Close()
+		if err != nil {
+			recover()
+			c.trace.event("list %s: %v", path, err)
+			return
+		}
+	}()
+	return
+}
+
+// Sets the Parser used by List for the output of LIST, such as one with
+// the time zone of the server. A Parser for UTC is used by default.
+func (c *ServerConn) SetParser(p *Parser) {
+	c.parser = p
+}
+
+// Sets the format of the listings of the session, overriding its
+// detection. Unless the format of the Parser is set, List detects it from
+// the reply to SYST and the first line it recognizes, then keeps it for
+// the session. AUTO_LIST_FORMAT starts the detection again.
+func (c *ServerConn) SetListFormat(format LIST_FORMAT) {
+	c.listFormat = format
+}
+
+// Returns the reply of the server to SYST, which names its operating
+// system, as "UNIX Type: L8". The reply is cached for the connection, as
+// is the refusal of a server which does not support SYST.
+func (c *ServerConn) Syst() (string, error) {
+	if c.syst != "" || c.systErr != nil {
+		return c.syst, c.systErr
+	}
+	_, msg, err := c.cmd(StatusName, "SYST")
+	if err != nil {
+		if _, ok := err.(*textproto.Error); ok {
+			c.systErr = err
+		}
+		return "", err
+	}
+	c.syst = msg
+	return msg, nil
+}
+
+func (c *ServerConn) listParser() *Parser {
+	if c.parser == nil {
+		return defaultParser
+	}
+	return c.parser
+}
+
+// Lists a directory with the MLSD command (RFC 3659). Unlike LIST, the
+// output of MLSD has a standard format, with exact sizes and times.
+func (c *ServerConn) MLSD(path string) (entries []*FTPListData, err error) {
+	conn, _, err := c.cmdDataConn("MLSD %s", path)
+	if err != nil {
+		return
+	}
+	r := c.newResponse(conn, "MLSD")
+	defer r.Close()
+
+	bio := bufio.NewReader(c.decodeReader(r))
 	for {
-		// fmt.Printf("listLine: ")
-		// fmt.Print("%v, %v", c, conn)
 		line, e := bio.ReadString('\n')
+		if line != "" {
+			if entry := ParseMLSxLine(line); entry != nil {
+				entries = append(entries, entry)
+			}
+		}
 		if e == io.EOF {
-			// fmt.Println("=")
 			break
 		} else if e != nil {
-			// fmt.Println("=")
-			// return nil, e
-			// ingnore the "unexpected multi-line response" err
-			return
+			return entries, e
 		}
+	}
+	return
+}
 
-		// fmt.Print(line)
-		ftplistdata := ParseLine(line)
-		entries = append(entries, ftplistdata)
+// Lists the entries of a directory, using MLSD when the server supports
+// it. Unparsable lines and the "." and ".." entries are left out.
+func (c *ServerConn) readDir(path string) ([]*FTPListData, error) {
+	var list []*FTPListData
+	var err error
+	if c.hasFeature("MLST") {
+		list, err = c.MLSD(path)
+	} else {
+		list, err = c.List(path)
+		if lerr, ok := err.(*ListingError); ok {
+			// keep the entries which could be parsed
+			c.trace.event("list %s: %v", path, lerr)
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, err
 	}
-	// fmt.Println("finished listline")
 
-	defer func() {
-		err := r.Close()
-		if err != nil {
-			recover()
-			fmt.Println(err)
-			return
+	entries := list[:0]
+	for _, entry := range list {
+		if entry == nil || entry.Name == "." || entry.Name == ".." {
+			continue
 		}
-	}()
-	return
+		if t := strings.ToLower(entry.Facts["type"]); t == "cdir" || t == "pdir" {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Reports whether path is a directory, by trying to change into it.
+// The current directory is restored afterwards.
+func (c *ServerConn) isDir(path string) (bool, error) {
+	cwd, err := c.CurrentDir()
+	if err != nil {
+		return false, err
+	}
+	if err = c.ChangeDir(path); err != nil {
+		if _, ok := err.(*textproto.Error); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, c.ChangeDir(cwd)
 }
 
 // Changes the current directory to the specified path.
@@ -294,10 +475,8 @@ func (c *ServerConn) ChangeDirToParent() error {
 func (c *ServerConn) CurrentDir() (string, error) {
 	_, msg, err := c.cmd(StatusPathCreated, "PWD")
 	if err != nil {
-		//fmt.Println("PWD err : ", err, "msg : ", msg)
 		return "", err
 	}
-	//fmt.Println("PWD success")
 	start := strings.Index(msg, "\"")
 	end := strings.LastIndex(msg, "\"")
 
@@ -305,37 +484,124 @@ func (c *ServerConn) CurrentDir() (string, error) {
 		return "", errors.New("Unsuported PWD response format")
 	}
 
-	return msg[start+1 : end], nil
+	return c.decode(msg[start+1 : end]), nil
 }
 
 // Retrieves a file from the remote FTP server.
 // The ReadCloser must be closed at the end of the operation.
 func (c *ServerConn) Retr(path string) (io.ReadCloser, error) {
-	conn, err := c.cmdDataConn("RETR %s", path)
+	conn, msg, err := c.cmdDataConn("RETR %s", path)
 	if err != nil {
 		return nil, err
 	}
 
-	r := &response{conn, c}
+	r := c.newResponse(conn, "RETR")
+	if c.progress != nil {
+		r.progress = newProgress(c.progress, path, transferSize(msg))
+	}
 	return r, nil
 }
 
+// Retrieves a file from the remote FTP server, starting at the given offset.
+// The server must support the REST command in stream mode.
+// The ReadCloser must be closed at the end of the operation.
+func (c *ServerConn) RetrFrom(path string, offset int64) (io.ReadCloser, error) {
+	if offset > 0 {
+		_, _, err := c.cmd(StatusRequestFilePending, "REST %d", offset)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c.Retr(path)
+}
+
+// Returns the size of a file on the remote FTP server, using the SIZE command.
+func (c *ServerConn) FileSize(path string) (int64, error) {
+	_, msg, err := c.cmd(StatusFile, "SIZE %s", path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+}
+
+// Returns the modification time of a file on the remote FTP server, using
+// the MDTM command.
+func (c *ServerConn) ModTime(path string) (time.Time, error) {
+	_, msg, err := c.cmd(StatusFile, "MDTM %s", path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parseMLSxTime(strings.TrimSpace(msg))
+}
+
+// Returns the features advertised by the server in reply to FEAT, keyed by
+// the upper-cased feature name. The reply is cached for the connection, as
+// is the refusal of a server which does not support FEAT.
+func (c *ServerConn) Features() (map[string]string, error) {
+	if c.features != nil || c.featErr != nil {
+		return c.features, c.featErr
+	}
+	_, msg, err := c.cmdLines(StatusSystem, "FEAT")
+	if err != nil {
+		if _, ok := err.(*textproto.Error); ok {
+			c.featErr = err
+		}
+		return nil, err
+	}
+
+	features := make(map[string]string)
+	lines := strings.Split(msg, "\n")
+	// the first and the last lines are the "Features:" and "End" texts
+	for i := 1; i < len(lines)-1; i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		name, params := line, ""
+		if n := strings.Index(line, " "); n > 0 {
+			name, params = line[:n], line[n+1:]
+		}
+		features[strings.ToUpper(name)] = params
+	}
+	c.features = features
+	return features, nil
+}
+
+// Reports whether the server advertised the named feature in reply to FEAT.
+func (c *ServerConn) hasFeature(name string) bool {
+	features, err := c.Features()
+	if err != nil {
+		return false
+	}
+	_, ok := features[name]
+	return ok
+}
+
 // Uploads a file to the remote FTP server.
 // This function gets the data from the io.Reader. Hint: io.Pipe()
 func (c *ServerConn) Stor(path string, r io.Reader) error {
-	conn, err := c.cmdDataConn("STOR %s", path)
+	conn, _, err := c.cmdDataConn("STOR %s", path)
 	if err != nil {
 		return err
 	}
 
-	_, err = io.Copy(conn, r)
-	conn.Close()
-	if err != nil {
-		return err
+	if c.progress != nil {
+		p := newProgress(c.progress, path, readerSize(r))
+		defer p.finish()
+		r = &progressReader{r: r, p: p}
 	}
+	start := time.Now()
+	n, err := io.Copy(conn, r)
+	conn.Close()
 
+	// the final reply is read even if the copy failed, so that the
+	// control connection can be used again
 	// _, _, err = c.conn.ReadCodeLine(StatusClosingDataConnection)
-	_, _, err = MyReadCodeLine(c.conn, StatusClosingDataConnection)
+	code, _, err2 := MyReadCodeLine(c.conn, StatusClosingDataConnection)
+	if err == nil {
+		err = err2
+	}
+	c.observeTransfer("STOR", start, n, code, err)
 	return err
 }
 
@@ -382,19 +648,53 @@ func (c *ServerConn) Quit() error {
 	return c.conn.Close()
 }
 
+func (c *ServerConn) newResponse(conn net.Conn, verb string) *response {
+	return &response{conn: conn, c: c, verb: verb, start: time.Now()}
+}
+
 func (r *response) Read(buf []byte) (int, error) {
+	if r.done {
+		return 0, io.EOF
+	}
 	n, err := r.conn.Read(buf)
+	r.n += int64(n)
+	if r.progress != nil {
+		r.progress.add(n)
+	}
 	if err == io.EOF {
 		// code, _, err2 := r.c.conn.ReadCodeLine(StatusClosingDataConnection)
 		code, _, err2 := MyReadCodeLine(r.c.conn, StatusClosingDataConnection)
 
 		if (err2 != nil) && (code != StatusPassiveMode) {
 			err = err2
+		} else {
+			err2 = nil
 		}
+		r.finish(code, err2)
 	}
 	return n, err
 }
 
+// Close closes the data connection. If the transfer was not read to the end,
+// the final reply of the server (usually 426 or 226) is read and discarded,
+// so that the control connection can be used again.
 func (r *response) Close() error {
-	return r.conn.Close()
+	err := r.conn.Close()
+	if !r.done {
+		code, _, err2 := MyReadCodeLine(r.c.conn, -1)
+		if err2 != nil && err == nil {
+			err = err2
+		}
+		r.finish(code, err2)
+	}
+	return err
+}
+
+// finish marks the end of the transfer, once its final reply is read.
+func (r *response) finish(code int, err error) {
+	r.done = true
+	if r.progress != nil {
+		r.progress.finish()
+	}
+	r.c.observeTransfer(r.verb, r.start, r.n, code, err)
 }
@@ -0,0 +1,130 @@
+package ftp
+
+import (
+	"net/textproto"
+	"testing"
+)
+
+func TestListFormatDetection(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.syst = "Windows_NT"
+	s.lists = map[string]string{
+		"/dos": "04-27-00  09:09PM       <DIR>          licensed\r\n" +
+			"04-14-99  03:47PM                  589 read;me.htm\r\n",
+		"/more": "11-18-03  10:16AM                   12 notes;v2.txt\r\n",
+		"/semi": "04-14-99  03:47PM                  589 read;me.htm\r\n" +
+			"04-27-00  09:09PM       <DIR>          licensed\r\n",
+	}
+	c := s.conn()
+
+	// a first line with a ';' is not taken for VMS
+	entries, err := c.List("/semi")
+	if err != nil || len(entries) != 2 || entries[0].Name != "read;me.htm" {
+		t.Fatalf("List = %+v, %v", entries, err)
+	}
+	if c.listFormat != MSDOS_LIST_FORMAT {
+		t.Errorf("listFormat = %v, want MSDOS", c.listFormat)
+	}
+	c.SetListFormat(AUTO_LIST_FORMAT)
+
+	syst, err := c.Syst()
+	if err != nil || syst != "Windows_NT" {
+		t.Fatalf("Syst = %q, %v", syst, err)
+	}
+	for _, dir := range []string{"/dos", "/more"} {
+		entries, err := c.List(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			if e.Mtime.IsZero() || e.MtimeType != REMOTE_MINUTE_MTIME_TYPE {
+				t.Errorf("List(%s) = %+v, not parsed as MSDOS", dir, e)
+			}
+		}
+	}
+	if c.listFormat != MSDOS_LIST_FORMAT {
+		t.Errorf("listFormat = %v, want MSDOS", c.listFormat)
+	}
+	if n := s.count("SYST"); n != 1 {
+		t.Errorf("SYST sent %d times, want 1", n)
+	}
+
+	// an explicit format is used as is, the lines it does not recognize
+	// are reported
+	c.SetListFormat(VMS_LIST_FORMAT)
+	entries, err = c.List("/more")
+	lerr, ok := err.(*ListingError)
+	if !ok || len(lerr.Lines) != 1 || lerr.Lines[0].Format != VMS_LIST_FORMAT || len(entries) != 0 {
+		t.Errorf("List = %+v, %v, want a ListingError", entries, err)
+	}
+}
+
+func TestListSkipsAndReports(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.lists = map[string]string{
+		"/": "total 42\r\n" +
+			"-rw-r--r--   1 root     other        531 Jan 29 03:26 README\r\n" +
+			"\r\n" +
+			"-rw-r--r--   1 root     other        531 Jan 29 03:26\r\n" +
+			"-rw-r--r--   1 root     other        12 Jan 29 03:26 notes\r\n",
+	}
+	c := s.conn()
+	entries, err := c.List("/")
+	lerr, ok := err.(*ListingError)
+	if !ok || len(lerr.Lines) != 1 {
+		t.Fatalf("List error = %v, want a ListingError of 1 line", err)
+	}
+	if pe := lerr.Lines[0]; pe.Line != "-rw-r--r--   1 root     other        531 Jan 29 03:26" || pe.Err != ErrUnrecognized {
+		t.Errorf("ParseError = %+v", pe)
+	}
+	if len(entries) != 2 || entries[0].Name != "README" || entries[1].Name != "notes" {
+		t.Errorf("List = %+v", entries)
+	}
+
+	// the entries which could be parsed are still listed by FS
+	names, err := NewFS(c, "/").ReadDir(".")
+	if err != nil || len(names) != 2 {
+		t.Errorf("ReadDir = %v, %v", names, err)
+	}
+}
+
+func TestSystFormat(t *testing.T) {
+	tests := map[string]LIST_FORMAT{
+		"UNIX Type: L8":                               UNIX_LIST_FORMAT,
+		"Windows_NT":                                  AUTO_LIST_FORMAT,
+		"VMS OpenVMS V8.3":                            VMS_LIST_FORMAT,
+		"OS/400 is the remote operating system.":      OS400_LIST_FORMAT,
+		"MVS is the operating system of this server.": AUTO_LIST_FORMAT,
+	}
+	for syst, want := range tests {
+		if got := systFormat(syst); got != want {
+			t.Errorf("systFormat(%q) = %v, want %v", syst, got, want)
+		}
+	}
+}
+
+func TestListAborted(t *testing.T) {
+	for _, code := range []int{StatusTransfertAborted, StatusActionAborted} {
+		s := newTestServer(t, map[string]string{"/pub/a.txt": "a", "/pub/b.txt": "b"})
+		s.lists = map[string]string{"/raw": "-rw-r--r--   1 owner    group   1 Jan  1 10:00 a.txt\r\n"}
+		s.aborts = map[string]int{"/raw": code, "/pub": code}
+		s.mlsd = true
+		c := s.conn()
+
+		entries, err := c.List("/raw")
+		if e, ok := err.(*textproto.Error); !ok || e.Code != code {
+			t.Errorf("List = %v, want a %d error", err, code)
+		}
+		if len(entries) != 1 || entries[0].Name != "a.txt" {
+			t.Errorf("List = %+v, want the entries read", entries)
+		}
+
+		entries, err = c.MLSD("/pub")
+		if e, ok := err.(*textproto.Error); !ok || e.Code != code || len(entries) != 3 {
+			t.Errorf("MLSD = %d entries, %v; want a %d error", len(entries), err, code)
+		}
+		if err = c.NoOp(); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package ftp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrUnrecognized is returned by a ListParser for a line which is not in
+// its format.
+var ErrUnrecognized = errors.New("ftp: listing line not recognized")
+
+// ErrSkipLine is returned by Parser.Parse for a line which is known not to
+// be an entry, such as the "total 42" of UNIX listings.
+var ErrSkipLine = errors.New("ftp: listing line is not an entry")
+
+// ParseError records a line of a listing which could not be parsed.
+type ParseError struct {
+	Line   string
+	Format LIST_FORMAT // format the line was parsed as, AUTO_LIST_FORMAT if none was guessed
+	Err    error       // ErrUnrecognized, or the error of the ListParser
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("ftp: cannot parse %q as a %v listing line: %v", e.Line, e.Format, e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// ListingError is returned with the entries of a listing, by List and
+// ParseListing, when some of its lines could not be parsed.
+type ListingError struct {
+	Lines []*ParseError
+}
+
+func (e *ListingError) Error() string {
+	if len(e.Lines) == 1 {
+		return e.Lines[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more lines)", e.Lines[0], len(e.Lines)-1)
+}
+
+// ListParser parses the lines of a format of LIST output. ParseListLine
+// parses a line with the settings of p, such as its time zone. It returns
+// ErrUnrecognized, or another error, if the line is not in its format,
+// and an entry with a Name otherwise.
+type ListParser interface {
+	ParseListLine(p *Parser, line string) (*FTPListData, error)
+}
+
+// ListParserFunc adapts a function to a ListParser.
+type ListParserFunc func(p *Parser, line string) (*FTPListData, error)
+
+func (f ListParserFunc) ParseListLine(p *Parser, line string) (*FTPListData, error) {
+	return f(p, line)
+}
+
+type listFormat struct {
+	name   string
+	parser ListParser
+}
+
+var (
+	listFormatsMu sync.RWMutex
+	// listFormats is indexed by LIST_FORMAT.
+	listFormats = []listFormat{
+		AUTO_LIST_FORMAT: {name: "auto"},
+		EPLF_LIST_FORMAT: {"eplf", ListParserFunc(func(p *Parser, line string) (*FTPListData, error) {
+			return parseEPLF(line)
+		})},
+		UNIX_LIST_FORMAT: {"unix", builtinParser(func(p *Parser, buf string) *FTPListData {
+			if fdata := p.parseUnixPrefixed(buf); fdata != nil {
+				return fdata
+			}
+			return p.parseUNIXStyle(buf)
+		})},
+		VMS_LIST_FORMAT: {"vms", builtinParser(func(p *Parser, buf string) *FTPListData {
+			if index := strings.Index(buf, ";"); index > 0 {
+				return p.parseMultinet(buf, index)
+			}
+			return nil
+		})},
+		MSDOS_LIST_FORMAT:       {"msdos", builtinParser((*Parser).parseMSDOS)},
+		MVS_DATASET_LIST_FORMAT: {"mvs-dataset", builtinParser((*Parser).parseMVSDataset)},
+		MVS_MEMBER_LIST_FORMAT:  {"mvs-member", builtinParser((*Parser).parseMVSMember)},
+		OS400_LIST_FORMAT:       {"os400", builtinParser((*Parser).parseOS400)},
+		TANDEM_LIST_FORMAT:      {"tandem", builtinParser((*Parser).parseTandem)},
+	}
+)
+
+// builtinParser adapts a parser of this package, which returns nil for the
+// lines it does not recognize. An entry without a Name is refused as well,
+// as a safeguard.
+func builtinParser(parse func(p *Parser, buf string) *FTPListData) ListParser {
+	return ListParserFunc(func(p *Parser, line string) (*FTPListData, error) {
+		if len(line) < 2 {
+			return nil, ErrUnrecognized
+		}
+		fdata := parse(p, line)
+		if fdata == nil || fdata.Name == "" {
+			return nil, ErrUnrecognized
+		}
+		return fdata, nil
+	})
+}
+
+/*
+RegisterListFormat adds a format of LIST output, for the servers whose
+listings none of the built-in formats understand. It returns the
+LIST_FORMAT which selects it, as the Format of a Parser or with
+SetListFormat.
+
+When the format of a listing is not known, the registered formats are
+tried first, in their order of registration, and the first one which
+recognizes a line is used. The built-in formats are guessed afterwards,
+from the first characters of the line. RegisterListFormat is usually
+called from an init function.
+*/
+func RegisterListFormat(name string, lp ListParser) LIST_FORMAT {
+	listFormatsMu.Lock()
+	defer listFormatsMu.Unlock()
+	listFormats = append(listFormats, listFormat{name, lp})
+	return LIST_FORMAT(len(listFormats) - 1)
+}
+
+// unregisterListFormat removes a format added by RegisterListFormat. The
+// LIST_FORMATs of the formats registered after it are kept.
+func unregisterListFormat(f LIST_FORMAT) {
+	listFormatsMu.Lock()
+	defer listFormatsMu.Unlock()
+	if f <= TANDEM_LIST_FORMAT || int(f) >= len(listFormats) {
+		return
+	}
+	if int(f) == len(listFormats)-1 {
+		listFormats = listFormats[:f]
+	} else {
+		listFormats[f].parser = nil
+	}
+}
+
+// String returns the name of the format, as "unix".
+func (f LIST_FORMAT) String() string {
+	listFormatsMu.RLock()
+	defer listFormatsMu.RUnlock()
+	if f < 0 || int(f) >= len(listFormats) {
+		return "LIST_FORMAT(" + strconv.Itoa(int(f)) + ")"
+	}
+	return listFormats[f].name
+}
+
+// listParserOf returns the ListParser of format f, nil for AUTO_LIST_FORMAT
+// and unknown formats.
+func listParserOf(f LIST_FORMAT) ListParser {
+	listFormatsMu.RLock()
+	defer listFormatsMu.RUnlock()
+	if f < 0 || int(f) >= len(listFormats) {
+		return nil
+	}
+	return listFormats[f].parser
+}
+
+// registeredFormats returns the formats added by RegisterListFormat, in
+// their order of registration.
+func registeredFormats() []LIST_FORMAT {
+	listFormatsMu.RLock()
+	defer listFormatsMu.RUnlock()
+	var formats []LIST_FORMAT
+	for f := TANDEM_LIST_FORMAT + 1; int(f) < len(listFormats); f++ {
+		if listFormats[f].parser != nil {
+			formats = append(formats, f)
+		}
+	}
+	return formats
+}
+
+// parseFormat parses line in format f.
+func (p *Parser) parseFormat(f LIST_FORMAT, line string) (*FTPListData, error) {
+	lp := listParserOf(f)
+	if lp == nil {
+		return nil, ErrUnrecognized
+	}
+	fdata, err := lp.ParseListLine(p, line)
+	if err == nil && (fdata == nil || fdata.Name == "") {
+		err = ErrUnrecognized
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fdata, nil
+}
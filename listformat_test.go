@@ -0,0 +1,99 @@
+package ftp
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// parseAppliance parses the listings of a made-up device:
+//
+//	"F|531|README"
+//	"D|0|etc"
+func parseAppliance(p *Parser, line string) (*FTPListData, error) {
+	fields := strings.Split(strings.TrimRight(line, "\r\n"), "|")
+	if len(fields) != 3 || (fields[0] != "F" && fields[0] != "D") {
+		return nil, ErrUnrecognized
+	}
+	size, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	fdata := &FTPListData{RawLine: line, Name: fields[2], Size: size}
+	if fields[0] == "D" {
+		fdata.TryCwd, fdata.Type = true, DIR_ENTRY_TYPE
+	} else {
+		fdata.TryRetr, fdata.Type = true, FILE_ENTRY_TYPE
+	}
+	return fdata, nil
+}
+
+// registerAppliance registers the appliance format for the duration of the
+// test, so that the other tests guess the formats without it.
+func registerAppliance(t *testing.T) LIST_FORMAT {
+	f := RegisterListFormat("appliance", ListParserFunc(parseAppliance))
+	t.Cleanup(func() { unregisterListFormat(f) })
+	return f
+}
+
+func TestRegisterListFormat(t *testing.T) {
+	if e := ParseLine("F|531|README"); e != nil {
+		t.Fatalf("ParseLine before the registration = %+v", e)
+	}
+	applianceFormat := registerAppliance(t)
+	if applianceFormat.String() != "appliance" || UNIX_LIST_FORMAT.String() != "unix" {
+		t.Errorf("String = %v, %v", applianceFormat, UNIX_LIST_FORMAT)
+	}
+
+	e := ParseLine("F|531|README")
+	if e == nil || e.Name != "README" || e.Size != 531 || !e.TryRetr {
+		t.Errorf("ParseLine = %+v", e)
+	}
+	// the built-in formats are still guessed
+	if e = ParseLine("-rw-r--r--   1 root     other     531 Jan 29 03:26 README"); e == nil || e.Name != "README" {
+		t.Errorf("ParseLine(unix) = %+v", e)
+	}
+
+	p := &Parser{Format: applianceFormat}
+	if _, err := p.parseFormat(applianceFormat, "F|many|README"); err == nil || err == ErrUnrecognized {
+		t.Errorf("parseFormat(bad size) = %v, want a parse error", err)
+	}
+	if _, err := p.parseFormat(UNIX_LIST_FORMAT, "total 8"); err != ErrUnrecognized {
+		t.Errorf("parseFormat(total) = %v, want ErrUnrecognized", err)
+	}
+	if e = p.ParseLine("-rw-r--r--   1 root     other     531 Jan 29 03:26 README"); e != nil {
+		t.Errorf("ParseLine(unix) = %+v, want nil", e)
+	}
+
+	s := newTestServer(t, nil)
+	s.lists = map[string]string{"/": "D|0|etc\r\nF|531|README\r\n"}
+	c := s.conn()
+	entries, err := c.List("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Name != "etc" || !entries[0].TryCwd || entries[1].Size != 531 {
+		t.Errorf("List = %+v", entries)
+	}
+	if c.listFormat != applianceFormat {
+		t.Errorf("listFormat = %v, want appliance", c.listFormat)
+	}
+}
+
+func TestUnregisterListFormat(t *testing.T) {
+	var f LIST_FORMAT
+	t.Run("registered", func(t *testing.T) {
+		f = registerAppliance(t)
+		if e := ParseLine("F|531|README"); e == nil {
+			t.Error("the appliance format is not used")
+		}
+	})
+	if e := ParseLine("F|531|README"); e != nil {
+		t.Errorf("ParseLine after the unregistration = %+v", e)
+	}
+	for _, g := range registeredFormats() {
+		if g == f {
+			t.Errorf("%v is still registered", f)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package ftp
+
+import (
+	"strings"
+	"time"
+)
+
+// EventKind tells what an Event describes.
+type EventKind int
+
+const (
+	// EventCommand is a command answered on the control connection.
+	EventCommand EventKind = iota
+	// EventDataCommand is a command which opens a data connection, such
+	// as RETR or LIST, up to its preliminary reply.
+	EventDataCommand
+	// EventTransfer is the transfer of data which follows an
+	// EventDataCommand, up to the final reply.
+	EventTransfer
+)
+
+// Event describes a command or a transfer, for an Observer.
+type Event struct {
+	Kind     EventKind
+	Verb     string        // command, such as "RETR"
+	Code     int           // reply code, 0 if no reply was read
+	Start    time.Time     // when the command was sent, or the transfer began
+	Duration time.Duration // time until the reply was read
+	Bytes    int64         // bytes moved by an EventTransfer
+	Err      error
+}
+
+// Observer is notified of the commands and transfers of a connection, for
+// metrics or tracing. Observe is called once each is over, and must not
+// use the connection.
+type Observer interface {
+	Observe(e Event)
+}
+
+// ObserverFunc adapts a function to an Observer.
+type ObserverFunc func(e Event)
+
+func (f ObserverFunc) Observe(e Event) {
+	f(e)
+}
+
+// SetObserver sets the observer of the connection, nil to remove it.
+func (c *ServerConn) SetObserver(o Observer) {
+	c.observer = o
+}
+
+// observeCmd notifies the observer of a command whose reply code and error
+// are in *code and *err. It is deferred by the command helpers.
+func (c *ServerConn) observeCmd(kind EventKind, format string, start time.Time, code *int, err *error) {
+	verb := format
+	if i := strings.IndexByte(format, ' '); i >= 0 {
+		verb = format[:i]
+	}
+	c.observer.Observe(Event{
+		Kind:     kind,
+		Verb:     verb,
+		Code:     *code,
+		Start:    start,
+		Duration: time.Since(start),
+		Err:      *err,
+	})
+}
+
+// observeTransfer notifies the observer of a transfer.
+func (c *ServerConn) observeTransfer(verb string, start time.Time, n int64, code int, err error) {
+	if c.observer == nil {
+		return
+	}
+	c.observer.Observe(Event{
+		Kind:     EventTransfer,
+		Verb:     verb,
+		Code:     code,
+		Start:    start,
+		Duration: time.Since(start),
+		Bytes:    n,
+		Err:      err,
+	})
+}
@@ -0,0 +1,55 @@
+package ftp
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestObserver(t *testing.T) {
+	s := newTestServer(t, map[string]string{"/file": "Just some text"})
+	c := s.conn()
+
+	var events []Event
+	c.SetObserver(ObserverFunc(func(e Event) { events = append(events, e) }))
+
+	if err := c.NoOp(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.Retr("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, r)
+	r.Close()
+	if err = c.Stor("/copy", strings.NewReader("data")); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Delete("/missing"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	want := []Event{
+		{Kind: EventCommand, Verb: "NOOP", Code: StatusCommandOK},
+		{Kind: EventDataCommand, Verb: "RETR", Code: StatusAboutToSend},
+		{Kind: EventTransfer, Verb: "RETR", Code: StatusClosingDataConnection, Bytes: 14},
+		{Kind: EventDataCommand, Verb: "STOR", Code: StatusAboutToSend},
+		{Kind: EventTransfer, Verb: "STOR", Code: StatusClosingDataConnection, Bytes: 4},
+		{Kind: EventCommand, Verb: "DELE", Code: StatusFileUnavailable},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, e := range events {
+		w := want[i]
+		if e.Kind != w.Kind || e.Verb != w.Verb || e.Code != w.Code || e.Bytes != w.Bytes {
+			t.Errorf("event %d = %+v, want %+v", i, e, w)
+		}
+		if e.Start.IsZero() || e.Duration <= 0 {
+			t.Errorf("event %d has no timing: %+v", i, e)
+		}
+		if (e.Err != nil) != (e.Code == StatusFileUnavailable) {
+			t.Errorf("event %d has error %v", i, e.Err)
+		}
+	}
+}
@@ -15,7 +15,8 @@ module is functionally similar to Bernstein's parser.
 Currently covered formats:
 
     - `EPLF`_
-- UNIX *ls*, with or without group ID
+    - MLSD/MLST (RFC 3659), see ParseMLSxLine
+- UNIX *ls*, with or without group ID, inode and block count
     - Microsoft FTP Service
     - Windows NT FTP Server
     - VMS
@@ -23,17 +24,28 @@ Currently covered formats:
 - NetPresenz (Mac)
     - NetWare
     - MSDOS
+    - IBM z/OS: MVS datasets and PDS members (ParseListing only), and
+      Unix System Services
+    - IBM i (OS/400)
+    - HP NonStop (Tandem) Guardian (ParseListing only)
 
 .. _EPLF: http://cr.yp.to/ftp/list/eplf.html
 
+Long VMS filenames, with information split across two lines, are joined
+by ParseListing only.
+
 Definitely not covered:
 
-- Long VMS filenames, with information split across two lines.
 - NCSA Telnet FTP server. Has LIST = NLST (and bad NLST for directories).
 
 */
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"time"
 	"strings"
 	"strconv"
@@ -76,13 +88,97 @@ ID_TYPE identifies how a file's identifier should be interpreted.
 - UNKNOWN: The ID is not set or its type is unknown.
 */
 
+type ENTRY_TYPE int
+const (
+	UNKNOWN_ENTRY_TYPE ENTRY_TYPE = iota
+	FILE_ENTRY_TYPE
+	DIR_ENTRY_TYPE
+	LINK_ENTRY_TYPE
+	BLOCK_DEVICE_ENTRY_TYPE
+	CHAR_DEVICE_ENTRY_TYPE
+	PIPE_ENTRY_TYPE
+	SOCKET_ENTRY_TYPE
+)
+/*
+ENTRY_TYPE identifies the kind of a listed entry.
+
+- FILE, DIR, LINK: A regular file, a directory or a symbolic link.
+- BLOCK_DEVICE, CHAR_DEVICE: A block or character special file.
+- PIPE, SOCKET: A named pipe or a Unix domain socket.
+- UNKNOWN: The listing does not tell.
+*/
+
+type LIST_FORMAT int
+const (
+	AUTO_LIST_FORMAT LIST_FORMAT = iota
+	EPLF_LIST_FORMAT
+	UNIX_LIST_FORMAT
+	VMS_LIST_FORMAT
+	MSDOS_LIST_FORMAT
+	MVS_DATASET_LIST_FORMAT
+	MVS_MEMBER_LIST_FORMAT
+	OS400_LIST_FORMAT
+	TANDEM_LIST_FORMAT
+)
+/*
+LIST_FORMAT selects the format of the ``LIST`` output, see Parser.Format.
+
+- AUTO: The format is guessed from each line, and from the header of
+  the listing in ParseListing.
+- EPLF, UNIX, VMS, MSDOS: As the formats of the header of this file.
+  UNIX covers Windows, NetWare, NetPresenz and z/OS Unix System Services
+  too; VMS covers MultiNet.
+- MVS_DATASET, MVS_MEMBER: z/OS datasets and PDS members.
+- OS400: IBM i (AS/400) objects.
+- TANDEM: HP NonStop (Tandem) Guardian files.
+
+More formats are added by RegisterListFormat.
+*/
+
 /*
 -----------------------------------------------------------
-Globals
+Parser
 -----------------------------------------------------------
 */
-var now = time.Now()
-var currentYear = now.Year()
+
+/*
+Parser holds the configuration for parsing ``LIST`` output. The zero
+value is ready to use, for a server whose listings are in UTC.
+*/
+type Parser struct {
+	// Location is the time zone of the server, in which the times of the
+	// listings are given. UTC is used when it is nil.
+	Location *time.Location
+
+	// Now returns the current time, against which the years missing from
+	// UNIX listings are guessed. time.Now is used when it is nil.
+	Now func() time.Time
+
+	// Format is the format of the listings. When it is AUTO_LIST_FORMAT,
+	// the zero value, the format is guessed.
+	Format LIST_FORMAT
+
+	// BlockSize is the size in bytes of the blocks in which VMS listings
+	// give file sizes. 512 is used when it is zero.
+	BlockSize int
+}
+
+// defaultParser is used by ParseLine.
+var defaultParser = &Parser{}
+
+func (p *Parser) location() *time.Location {
+	if p.Location == nil {
+		return time.UTC
+	}
+	return p.Location
+}
+
+func (p *Parser) now() time.Time {
+	if p.Now == nil {
+		return time.Now()
+	}
+	return p.Now()
+}
 
 
 /*
@@ -123,6 +219,34 @@ id_type : `ID_TYPE`
 
 link_dest :  Link destination when listing is a link
 
+type : `ENTRY_TYPE`
+            The kind of the entry. See `ENTRY_TYPE`.
+
+mode : `fs.FileMode`
+            The type and permission bits of the entry, including setuid,
+            setgid and sticky. Only set when the listing shows them.
+
+nlink : int
+            The number of hard links, for Unix listings.
+
+owner, group : str
+            The owner and group of the entry, if the listing shows them.
+            For VMS, these are the member and group of the UIC.
+
+protection : str
+            The VMS protection of the entry, as "RWED,RWED,RE,RE", or the
+            Tandem Guardian security, as "NUNU".
+
+recfm, lrecl, blksz, dsorg :
+            The record format, record length, block size and dataset
+            organization of an MVS dataset, as "FB", 80, 6160 and "PS".
+
+file_code : int
+            The file code of a Tandem Guardian file, as 101 for an edit file.
+
+facts : map
+            The facts of an MLSD/MLST entry, keyed by lower-cased fact name.
+
 */
 type FTPListData struct {
 
@@ -136,6 +260,18 @@ type FTPListData struct {
 	IdType ID_TYPE
 	Id string
 	LinkDest string
+	Type ENTRY_TYPE
+	Mode fs.FileMode
+	Nlink int
+	Owner string
+	Group string
+	Protection string
+	Recfm string
+	Lrecl int
+	BlkSz int
+	Dsorg string
+	FileCode int
+	Facts map[string]string
 }
 
 func newFTPListData(rawLine string) (fdata *FTPListData) {
@@ -151,70 +287,338 @@ func newFTPListData(rawLine string) (fdata *FTPListData) {
 	return
 }
 
+// isDir reports whether the entry is known to be a directory, rather than a
+// file or a link which might lead to a directory.
+func (fdata *FTPListData) isDir() bool {
+	return fdata.TryCwd && !fdata.TryRetr && !fdata.isLink()
+}
+
+// isLink reports whether the entry is a symbolic link, or another kind of
+// link such as a Windows junction.
+func (fdata *FTPListData) isLink() bool {
+	return fdata.LinkDest != "" || fdata.Type == LINK_ENTRY_TYPE
+}
+
+// ParseLine parses a line of ``LIST`` output with the default Parser, for a
+// server in UTC. It returns nil if the line is not recognized.
 func ParseLine(ftpListLine string) (fdata *FTPListData) {
-	buf := ftpListLine
+	return defaultParser.ParseLine(ftpListLine)
+}
+
+// ParseLine parses a line of ``LIST`` output. It returns nil if the line is
+// not recognized.
+func (p *Parser) ParseLine(ftpListLine string) (fdata *FTPListData) {
+	fdata, _ = p.Parse(ftpListLine)
+	return
+}
+
+/*
+Parse parses a line of ``LIST`` output. Unlike ParseLine, it tells why a
+line gives no entry: the error is ErrSkipLine for the lines which are
+known not to be entries, such as "total 42", blank lines and the headers
+of MVS or Tandem listings, and a *ParseError for the others. A returned
+entry is always complete.
+*/
+func (p *Parser) Parse(line string) (*FTPListData, error) {
+	if isSkipLine(line) || p.headerFormat(line) != AUTO_LIST_FORMAT {
+		return nil, ErrSkipLine
+	}
+	var fdata *FTPListData
+	var err error
+	format := p.Format
+	if format != AUTO_LIST_FORMAT {
+		fdata, err = p.parseFormat(format, line)
+	} else {
+		fdata, format, err = p.guessLine(line)
+	}
+	if err != nil {
+		return nil, &ParseError{Line: line, Format: format, Err: err}
+	}
+	return fdata, nil
+}
+
+// guessLine parses a line of a listing in an unknown format, and returns
+// the format it was parsed as. The formats of RegisterListFormat are tried
+// first, then the built-in formats the line may be in, most likely first.
+// If none recognizes the line, the most likely one is returned.
+func (p *Parser) guessLine(buf string) (*FTPListData, LIST_FORMAT, error) {
+	for _, f := range registeredFormats() {
+		if fdata, err := p.parseFormat(f, buf); err == nil {
+			return fdata, f, nil
+		}
+	}
+	formats := guessFormats(buf)
+	if len(formats) == 0 {
+		return nil, AUTO_LIST_FORMAT, ErrUnrecognized
+	}
+	var first error
+	for _, f := range formats {
+		fdata, err := p.parseFormat(f, buf)
+		if err == nil {
+			return fdata, f, nil
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return nil, formats[0], first
+}
+
+// guessFormats returns the built-in formats a line may be in, by its first
+// characters, the most likely first. A DOS line may hold a ';' as VMS
+// lines do, so both are returned for it.
+func guessFormats(buf string) []LIST_FORMAT {
 	if len(buf) < 2 {
 		//an empty name in EPLF, with no info, could be 2 chars
 		return nil
 	}
+	var formats []LIST_FORMAT
+	if isOS400(buf) {
+		formats = append(formats, OS400_LIST_FORMAT)
+	}
 	c := byte(buf[0])
 	switch c {
 	case '+':
-		return parseEPLF(buf)
+		formats = append(formats, EPLF_LIST_FORMAT)
 	case 'b', 'c', 'd', 'l', 'p', 's', '-':
-		return parseUNIXStyle(buf)
-		
+		formats = append(formats, UNIX_LIST_FORMAT)
+	}
+	if c == ' ' || (c >= '0' && c <= '9') {
+		if _, _, ok := splitUnixPrefix(buf); ok {
+			formats = append(formats, UNIX_LIST_FORMAT)
+		}
 	}
 	if index := strings.Index(buf, ";"); index > 0 {
-		return parseMultinet(buf, index)
+		formats = append(formats, VMS_LIST_FORMAT)
 	}
 	if c >= '0' && c <= '9' {
-		return parseMSDOS(buf)
+		formats = append(formats, MSDOS_LIST_FORMAT)
+	}
+	return formats
+}
+
+// isSkipLine reports whether line is known not to be an entry, in any of
+// the formats: a blank line, the "total 42" of UNIX, the "Directory" and
+// "Total of" lines of VMS, or the "File(s)" and "Dir(s)" of MSDOS.
+func isSkipLine(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true
+	}
+	switch strings.ToLower(fields[0]) {
+	case "total":
+		// "total 42", but also "Total of 2 files, 214/217 blocks."
+		return len(fields) == 2 || (len(fields) > 2 && strings.ToLower(fields[1]) == "of")
+	case "grand":
+		return len(fields) > 2 && strings.ToLower(fields[1]) == "total"
+	case "directory":
+		// "Directory USER1:[ANONYMOUS]"
+		return len(fields) == 2 && strings.HasSuffix(fields[1], "]")
+	}
+	if len(fields) >= 2 {
+		switch strings.ToLower(fields[1]) {
+		case "file(s)", "dir(s)":
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ParseListing parses the whole output of ``LIST``, read from r. Unlike
+ParseLine, it joins the entries of VMS servers whose long file names
+take a line of their own:
+
+	"A_VERY_LONG_FILE_NAME_INDEED.TXT;1"
+	"                   213/216  29-JAN-1996 03:33:12  [ANONYMOU,ANONYMOUS]   (RWED,RWED,,)"
+
+It also recognizes the listings of MVS datasets, PDS members and Tandem
+Guardian by their header line. Otherwise, unless the Format of p is set,
+the format of the first line which is recognized is used for all the
+others.
+
+The lines which are known not to be entries are left out, see Parse. If
+other lines are not recognized, the entries of the rest are returned with
+a *ListingError.
+*/
+func (p *Parser) ParseListing(r io.Reader) (entries []*FTPListData, err error) {
+	entries, _, bad, err := p.parseListing(r, AUTO_LIST_FORMAT)
+	if err == nil && len(bad) > 0 {
+		err = &ListingError{Lines: bad}
+	}
+	return entries, err
+}
+
+// parseListing is ParseListing, with a hint of the format of the listing,
+// which is tried first. It returns the format the lines were parsed as,
+// or AUTO_LIST_FORMAT if none were or if a header told the format, and
+// the lines which were not recognized apart from the error of r.
+func (p *Parser) parseListing(r io.Reader, hint LIST_FORMAT) (entries []*FTPListData, format LIST_FORMAT, bad []*ParseError, err error) {
+	format = p.Format
+	header := AUTO_LIST_FORMAT
+	add := func(line string) {
+		if isSkipLine(line) {
+			return
+		}
+		var fdata *FTPListData
+		var perr error
+		tried := format
+		switch {
+		case header != AUTO_LIST_FORMAT:
+			tried = header
+			fdata, perr = p.parseFormat(header, line)
+		case format != AUTO_LIST_FORMAT:
+			fdata, perr = p.parseFormat(format, line)
+		default:
+			fdata, tried, perr = p.detectLine(line, hint)
+			if perr == nil {
+				format = tried
+			}
+		}
+		if perr != nil {
+			bad = append(bad, &ParseError{Line: line, Format: tried, Err: perr})
+			return
+		}
+		entries = append(entries, fdata)
+	}
+
+	scanner := bufio.NewScanner(r)
+	pending := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		if f := p.headerFormat(line); f != AUTO_LIST_FORMAT {
+			header = f
+			continue
+		}
+		if pending != "" {
+			line = pending + " " + strings.TrimLeft(line, " \t")
+			pending = ""
+		} else if isVMSName(line) {
+			pending = strings.TrimRight(line, " \t\r")
+			continue
+		}
+		add(line)
+	}
+	if pending != "" {
+		add(pending)
+	}
+	if header != AUTO_LIST_FORMAT {
+		format = p.Format
+	}
+	return entries, format, bad, scanner.Err()
+}
+
+// detectLine parses a line of a listing in an unknown format, trying the
+// format hint first. It returns the format the line was parsed as, or the
+// one it was guessed to be in if it was not recognized.
+func (p *Parser) detectLine(line string, hint LIST_FORMAT) (*FTPListData, LIST_FORMAT, error) {
+	if hint != AUTO_LIST_FORMAT {
+		if fdata, err := p.parseFormat(hint, line); err == nil {
+			return fdata, hint, nil
+		}
+	}
+	return p.guessLine(line)
+}
+
+// systFormat returns the listing format of a server by its reply to SYST,
+// or AUTO_LIST_FORMAT if it does not tell.
+func systFormat(syst string) LIST_FORMAT {
+	syst = strings.ToUpper(syst)
+	switch {
+	case strings.Contains(syst, "OS/400"):
+		return OS400_LIST_FORMAT
+	case strings.Contains(syst, "VMS"):
+		return VMS_LIST_FORMAT
+	case strings.Contains(syst, "NONSTOP"), strings.Contains(syst, "TANDEM"):
+		return TANDEM_LIST_FORMAT
+	case strings.HasPrefix(syst, "UNIX"), strings.HasPrefix(syst, "NETWARE"), strings.HasPrefix(syst, "MACOS"):
+		return UNIX_LIST_FORMAT
 	}
-	return nil
+	// Windows servers may list in either the MSDOS or the UNIX format, and
+	// z/OS ones tell the format by a header.
+	return AUTO_LIST_FORMAT
 }
 
+// isVMSName reports whether line holds nothing but a VMS file name with
+// its version, as "NAME.EXT;1", the rest of the entry being on the next line.
+func isVMSName(line string) bool {
+	line = strings.Trim(line, " \t\r")
+	i := strings.Index(line, ";")
+	if i <= 0 || i == len(line)-1 || strings.ContainsAny(line, " \t") {
+		return false
+	}
+	return strings.Trim(line[i+1:], "0123456789") == ""
+}
 
-func parseEPLF(buf string) (fdata *FTPListData) {
+func parseEPLF(buf string) (fdata *FTPListData, err error) {
 	/*
 	  see http://cr.yp.to/ftp/list/eplf.html
 	  "+i8388621.29609,m824255902,/,\tdev"
-	  "+i8388621.44468,m839956783,r,s10376,\tRFCEPLF"
+	  "+i8388621.44468,m839956783,r,s10376,up644,\tRFCEPLF"
+
+	  The facts, each named by its first letter ("up" for the
+	  permissions), are kept in Facts, the unknown ones too.
 	*/
 	fdata = newFTPListData(buf)
-	buf = strings.Trim(buf, "\t\n\r ")
-	i := 1
-	for j:=1 ; j<len(buf); j++ {
-		if buf[j] == '\t' {
-			fdata.Name = buf[j+1:]
-			break
+	buf = strings.TrimRight(buf, "\r\n")
+	if len(buf) < 2 || buf[0] != '+' {
+		return nil, ErrUnrecognized
+	}
+	tab := strings.IndexByte(buf, '\t')
+	if tab < 0 || tab == len(buf)-1 {
+		return nil, errors.New("ftp: EPLF line without a name")
+	}
+	fdata.Name = buf[tab+1:]
+	fdata.Facts = make(map[string]string)
+
+	for _, fact := range strings.Split(buf[1:tab], ",") {
+		if fact == "" {
+			continue
 		}
-		if buf[j] == ',' {
-			c := buf[i]
-			switch c {
-			case '/':
-				fdata.TryCwd = true
-			case 'r':
-				fdata.TryRetr = true
-			case 's':
-				size, err := strconv.ParseUint(buf[i+1:j], 10, 64)
-				if err != nil { return nil }
-				fdata.Size = size
-			case 'm':
-				fdata.MtimeType = LOCAL_MTIME_TYPE
-				unixtime, err := strconv.ParseInt(buf[i+1:j], 10, 64)
-				if err != nil { return nil }
-				fdata.Mtime = time.Unix(unixtime, 0)
-			case 'i':
-				fdata.IdType = FULL_ID_TYPE
-				fdata.Id = buf[i+1:j-i-1]
-				
+		name, value := fact[:1], fact[1:]
+		switch name {
+		case "/":
+			fdata.TryCwd = true
+		case "r":
+			fdata.TryRetr = true
+		case "s":
+			if fdata.Size, err = strconv.ParseUint(value, 10, 64); err != nil {
+				return nil, fmt.Errorf("ftp: bad EPLF size %q", value)
+			}
+		case "m":
+			unixtime, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("ftp: bad EPLF modification time %q", value)
 			}
-			i = j+1
+			fdata.MtimeType = LOCAL_MTIME_TYPE
+			fdata.Mtime = time.Unix(unixtime, 0)
+		case "i":
+			fdata.IdType = FULL_ID_TYPE
+			fdata.Id = value
+		case "u":
+			if !strings.HasPrefix(value, "p") {
+				break
+			}
+			name, value = "up", value[1:]
+			mode, err := strconv.ParseUint(value, 8, 32)
+			if err != nil {
+				return nil, fmt.Errorf("ftp: bad EPLF permissions %q", value)
+			}
+			fdata.Mode = unixMode(uint32(mode))
 		}
-		
+		fdata.Facts[name] = value
 	}
-	return
+
+	switch {
+	case fdata.TryCwd && !fdata.TryRetr:
+		fdata.Type = DIR_ENTRY_TYPE
+	case fdata.TryRetr && !fdata.TryCwd:
+		fdata.Type = FILE_ENTRY_TYPE
+	}
+	if fdata.Mode != 0 {
+		fdata.Mode |= entryTypeMode[fdata.Type]
+	}
+	return fdata, nil
 }
 
 /*
@@ -227,13 +631,15 @@ func parseEPLF(buf string) (fdata *FTPListData) {
 
 */
 
-func guessTime(month time.Month, mday, hour, minute int) (t int64) {
+func (p *Parser) guessTime(month time.Month, mday, hour, minute int) (t int64) {
 	
+	now := p.now()
+	currentYear := now.In(p.location()).Year()
 	year := 0 
 	t = 0
 	ul := currentYear + 100
 	for year = currentYear - 1 ; year < ul ; year ++ {
-		t = getMtime(year, month, mday, hour, minute, 0)
+		t = p.getMtime(year, month, mday, hour, minute, 0)
 		if (now.Unix() - t) < (350 * 86400) {
 			return t
 		}
@@ -242,9 +648,8 @@ func guessTime(month time.Month, mday, hour, minute int) (t int64) {
 	
 }
 
-func getMtime(year int, month time.Month, mday, hour, minute, second int) (t int64) {
-	l, _ := time.LoadLocation("UTC")
-	return time.Date(year, month, mday, hour, minute, second, 0, l).Unix()
+func (p *Parser) getMtime(year int, month time.Month, mday, hour, minute, second int) (t int64) {
+	return time.Date(year, month, mday, hour, minute, second, 0, p.location()).Unix()
 }
 
 func getMonth(buf string) (m time.Month) {
@@ -263,7 +668,7 @@ func parseInt(num string) (n int) {
 	return int(x)
 }
 
-func parseUNIXStyle(buf string) (fdata *FTPListData) {
+func (p *Parser) parseUNIXStyle(buf string) (fdata *FTPListData) {
 	/*
 	
 	 UNIX-style listing, without inum and without blocks:
@@ -292,7 +697,11 @@ func parseUNIXStyle(buf string) (fdata *FTPListData) {
 	fdata = newFTPListData(buf)
 	buf = strings.Trim(buf, "\t\n\r ")
 	buflen := len(buf)
+	if buflen < 2 {
+		return nil
+	}
 	c := buf[0]
+	fdata.Type = unixEntryType[c]
 	switch c {
 	case 'd':
 		fdata.TryCwd = true
@@ -309,23 +718,31 @@ func parseUNIXStyle(buf string) (fdata *FTPListData) {
 	var hour int = 0
 	var minute int = 0
 	var year int = 0
+	var group string
 	state := 1
 	i := 0
 	//tokens := strings.Fields(buf)
 	for j:=1 ; j<buflen ; j++ {
 
 		if (buf[j] == ' ') && (buf[j-1] != ' ') {
-			if state == 1 { // skipping perm
+			if state == 1 { // getting perm
+				if mode, ok := parsePerm(buf[i:j]); ok {
+					fdata.Mode = mode
+				}
 				state = 2
-			} else if state == 2 { //skipping nlink
+			} else if state == 2 { // getting nlink
 				state = 3
 				if (j-i) == 6 && (buf[i] == 'f') { // Netpresenz
 					state = 4
+				} else {
+					fdata.Nlink = parseInt(buf[i:j])
 				}
-			} else if state == 3 { // skipping UID/GID
+			} else if state == 3 { // getting UID
+				fdata.Owner = buf[i:j]
 				state = 4
-			} else if state == 4 { // getting tentative size
+			} else if state == 4 { // getting tentative size, or GID
 				size, _ = strconv.ParseUint(buf[i:j], 10, 64)
+				group = buf[i:j]
 				state = 5
 			} else if state == 5 { // searching for month, else getting tentative size
 				month = getMonth(buf[i:j])
@@ -333,6 +750,7 @@ func parseUNIXStyle(buf string) (fdata *FTPListData) {
 					state = 6
 				} else {
 					size, _ = strconv.ParseUint(buf[i:j], 10, 64)
+					fdata.Group = group
 				}
 			} else if state == 6 { // have size and month
 				mday = parseInt(buf[i:j])
@@ -342,16 +760,16 @@ func parseUNIXStyle(buf string) (fdata *FTPListData) {
 					hour = parseInt(string(buf[i]))
 					minute = parseInt(buf[i+2:i+4])
 					fdata.MtimeType = REMOTE_MINUTE_MTIME_TYPE
-					fdata.Mtime = time.Unix(guessTime(month, mday, hour, minute), 0)
+					fdata.Mtime = time.Unix(p.guessTime(month, mday, hour, minute), 0)
 				} else if (j - i == 5) && (buf[i+2] == ':') {
 					hour = parseInt(buf[i:i+2])
 					minute = parseInt(buf[i+3:i+5])
 					fdata.MtimeType = REMOTE_MINUTE_MTIME_TYPE
-					fdata.Mtime = time.Unix(guessTime(month, mday, hour, minute), 0)
+					fdata.Mtime = time.Unix(p.guessTime(month, mday, hour, minute), 0)
 				} else if (j - i) >= 4 {
 					year = parseInt(buf[i:j])
 					fdata.MtimeType = REMOTE_DAY_MTIME_TYPE
-					fdata.Mtime = time.Unix(getMtime(year, month, mday, 0, 0, 0), 0)
+					fdata.Mtime = time.Unix(p.getMtime(year, month, mday, 0, 0, 0), 0)
 				} else {
 					break
 				}
@@ -367,6 +785,10 @@ func parseUNIXStyle(buf string) (fdata *FTPListData) {
 		}
 	
 	}
+	if state != 8 {
+		// no name after the date
+		return nil
+	}
 	fdata.Size = size
 	if c == 'l' {
 		for i=0 ; (i + 3) < len(fdata.Name) ; i++ {
@@ -391,7 +813,138 @@ func parseUNIXStyle(buf string) (fdata *FTPListData) {
 	return
 }
 
+// headerFormat returns the format of the lines following line, if it is
+// the header of a listing whose format is told by it, and
+// AUTO_LIST_FORMAT otherwise.
+func (p *Parser) headerFormat(line string) LIST_FORMAT {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return AUTO_LIST_FORMAT
+	}
+	switch {
+	case fields[0] == "Volume" && fields[1] == "Unit":
+		return MVS_DATASET_LIST_FORMAT
+	case fields[0] == "Name" && fields[1] == "VV.MM":
+		return MVS_MEMBER_LIST_FORMAT
+	case fields[0] == "File" && fields[1] == "Code" && fields[2] == "EOF":
+		return TANDEM_LIST_FORMAT
+	}
+	return AUTO_LIST_FORMAT
+}
+
+// parseUnixPrefixed parses a Unix listing line with inode and block count
+// columns, see splitUnixPrefix. It returns nil for other lines.
+func (p *Parser) parseUnixPrefixed(buf string) (fdata *FTPListData) {
+	inode, rest, ok := splitUnixPrefix(buf)
+	if !ok {
+		return nil
+	}
+	if fdata = p.parseUNIXStyle(rest); fdata == nil {
+		return nil
+	}
+	fdata.RawLine = buf
+	if inode != "" {
+		fdata.IdType = FULL_ID_TYPE
+		fdata.Id = inode
+	}
+	return fdata
+}
+
+// splitUnixPrefix splits the numeric columns printed by "ls -lis", the
+// inode and the block count, off a Unix listing line:
+//
+//	" 1523  8 -rw-r--r--   1 root     other        531 Jan 29 03:26 README"
+//
+// ok is false unless the columns are followed by a permission string. As a
+// single column may be either the inode or the block count, inode is only
+// set when both are present.
+func splitUnixPrefix(buf string) (inode, rest string, ok bool) {
+	var cols []string
+	rest = strings.TrimLeft(buf, " ")
+	for len(cols) < 2 {
+		k := strings.IndexByte(rest, ' ')
+		if k <= 0 || strings.Trim(rest[:k], "0123456789") != "" {
+			break
+		}
+		cols = append(cols, rest[:k])
+		rest = strings.TrimLeft(rest[k:], " ")
+	}
+	k := strings.IndexByte(rest, ' ')
+	if len(cols) == 0 || k < 0 {
+		return "", buf, false
+	}
+	if _, ok = parsePerm(rest[:k]); !ok {
+		return "", buf, false
+	}
+	if len(cols) == 2 {
+		inode = cols[0]
+	}
+	return inode, rest, true
+}
+
+// unixEntryType maps the first letter of a Unix permission string to the
+// type of the entry.
+var unixEntryType = map[byte]ENTRY_TYPE{
+	'-': FILE_ENTRY_TYPE,
+	'd': DIR_ENTRY_TYPE,
+	'l': LINK_ENTRY_TYPE,
+	'b': BLOCK_DEVICE_ENTRY_TYPE,
+	'c': CHAR_DEVICE_ENTRY_TYPE,
+	'p': PIPE_ENTRY_TYPE,
+	's': SOCKET_ENTRY_TYPE,
+}
+
+// entryTypeMode maps the type of an entry to the type bits of its mode.
+var entryTypeMode = map[ENTRY_TYPE]fs.FileMode{
+	DIR_ENTRY_TYPE:          fs.ModeDir,
+	LINK_ENTRY_TYPE:         fs.ModeSymlink,
+	BLOCK_DEVICE_ENTRY_TYPE: fs.ModeDevice,
+	CHAR_DEVICE_ENTRY_TYPE:  fs.ModeDevice | fs.ModeCharDevice,
+	PIPE_ENTRY_TYPE:         fs.ModeNamedPipe,
+	SOCKET_ENTRY_TYPE:       fs.ModeSocket,
+}
+
+// parsePerm parses a Unix permission string such as "drwxr-sr-t". It may be
+// followed by a '+', '.' or '@' marking ACLs or extended attributes. ok is
+// false if perm is not such a string, e.g. for NetWare listings.
+func parsePerm(perm string) (mode fs.FileMode, ok bool) {
+	if len(perm) == 11 && strings.IndexByte("+.@", perm[10]) >= 0 {
+		perm = perm[:10]
+	}
+	if len(perm) != 10 {
+		return 0, false
+	}
+	t, ok := unixEntryType[perm[0]]
+	if !ok {
+		return 0, false
+	}
+	mode = entryTypeMode[t]
+	for k := 1; k < 10; k++ {
+		bit := fs.FileMode(1) << uint(9-k)
+		switch c := perm[k]; {
+		case c == '-':
+		case c == "rwx"[(k-1)%3]:
+			mode |= bit
+		case k == 3 && (c == 's' || c == 'S'):
+			mode |= fs.ModeSetuid
+		case k == 6 && (c == 's' || c == 'S'):
+			mode |= fs.ModeSetgid
+		case k == 9 && (c == 't' || c == 'T'):
+			mode |= fs.ModeSticky
+		default:
+			return 0, false
+		}
+		if c := perm[k]; c == 's' || c == 't' {
+			mode |= bit
+		}
+	}
+	return mode, true
+}
+
 func indexAfter(s, sep string, i int) int {
+	if i < 0 || i > len(s) {
+		return -1
+	}
 	x := i + strings.Index(s[i:], sep)
 	if x < i {
 		return -1
@@ -400,6 +953,9 @@ func indexAfter(s, sep string, i int) int {
 }
 
 func skip(s string, i int, c byte) int {
+	if i < 0 || i >= len(s) {
+		return -1
+	}
 	for s[i] == c {
 		i += 1
 		if i == len(s) {
@@ -409,7 +965,42 @@ func skip(s string, i int, c byte) int {
 	return i
 }
 
-func parseMultinet(buf string, i int) (fdata *FTPListData) {
+// vmsSize returns the size in bytes of a VMS size column, a number of used
+// blocks optionally followed by the allocated blocks, as "213/216".
+func (p *Parser) vmsSize(col string) uint64 {
+	if k := strings.Index(col, "/"); k >= 0 {
+		col = col[:k]
+	}
+	blocks, _ := strconv.ParseUint(col, 10, 64)
+	size := uint64(p.BlockSize)
+	if size == 0 {
+		size = 512
+	}
+	return blocks * size
+}
+
+// vmsMode converts a VMS protection, as "RWED,RWED,RE,RE" for the system,
+// owner, group and world, to the permission bits of an fs.FileMode. The
+// system category and the delete access have no equivalent.
+func vmsMode(protection string) (mode fs.FileMode) {
+	categories := strings.Split(protection, ",")
+	for k := 1; k < len(categories) && k < 4; k++ {
+		shift := uint(3 * (3 - k))
+		for _, c := range categories[k] {
+			switch c {
+			case 'R':
+				mode |= 04 << shift
+			case 'W':
+				mode |= 02 << shift
+			case 'E':
+				mode |= 01 << shift
+			}
+		}
+	}
+	return
+}
+
+func (p *Parser) parseMultinet(buf string, i int) (fdata *FTPListData) {
 
 	/*
 
@@ -424,6 +1015,9 @@ func parseMultinet(buf string, i int) (fdata *FTPListData) {
 		
 	fdata = newFTPListData(buf)
 	buf = strings.Trim(buf, "\t\n\r ")
+	if i = strings.Index(buf, ";"); i <= 0 {
+		return nil
+	}
 	fdata.Name = buf[:i]
 	buflen := len(buf)
 
@@ -438,75 +1032,99 @@ func parseMultinet(buf string, i int) (fdata *FTPListData) {
 			l := len(fdata.Name)
 			fdata.Name = fdata.Name[0:l-4]
 			fdata.TryCwd = true
+			fdata.Type = DIR_ENTRY_TYPE
 		}
 	}
 
 	if fdata.TryCwd == false {
 		fdata.TryRetr = true
+		fdata.Type = FILE_ENTRY_TYPE
 	}
 
-	for p:=0 ; p < 2 ; p++ {
-		
-		if i = indexAfter(buf, " ", i); i == -1 {
-			return
-		}
-
-		if i = skip(buf, i, ' '); i == -1 {
-			return
-		}
+	if i = indexAfter(buf, " ", i); i == -1 {
+		return nil
+	}
+	if i = skip(buf, i, ' '); i == -1 {
+		return nil
 	}
 	j := i
+	if j = indexAfter(buf, " ", j); j == -1 {
+		return nil
+	}
+	fdata.Size = p.vmsSize(buf[i:j])
+	if i = skip(buf, j, ' '); i == -1 {
+		return nil
+	}
+
+	j = i
 	if j = indexAfter(buf, "-", j); j == -1 {
-		return
+		return nil
 	}
 	mday = parseInt(buf[i:j])
 
 	if j = skip(buf, j, '-'); j == -1 {
-		return
+		return nil
 	}
 	i = j
 	if j = indexAfter(buf, "-", j); j == -1 {
-		return
+		return nil
 	}
 	
 	if month = getMonth(buf[i:j]); month < 0 {
-		return
+		return nil
 	}
 	if j = skip(buf, j, '-'); j == -1 {
-		return
+		return nil
 	}
 	i = j
 	if j = indexAfter(buf, " ", j); j == -1 {
-		return
+		return nil
 	}
 	year = parseInt(buf[i:j])
 	if j = skip(buf, j, ' '); j == -1 {
-		return
+		return nil
 	}
 	i = j
 	if j = indexAfter(buf, ":", j); j == -1 {
-		return
+		return nil
 	}
 	hour = parseInt(buf[i:j])
 	if j = skip(buf, j, ':'); j == -1 {
-		return
+		return nil
 	}
 	i = j
 	for (buf[j] != ':') && (buf[j] != ' ') {
 		j += 1
 		if j == buflen {
-			return
+			return nil
 		}
 	}
 	minute = parseInt(buf[i:j])
 	
 	fdata.MtimeType = REMOTE_MINUTE_MTIME_TYPE
-	fdata.Mtime = time.Unix(getMtime(year, month, mday, hour, minute, 0), 0)
+	fdata.Mtime = time.Unix(p.getMtime(year, month, mday, hour, minute, 0), 0)
+
+	if i = indexAfter(buf, "[", j); i != -1 {
+		if k := indexAfter(buf, "]", i); k != -1 {
+			uic := buf[i+1 : k]
+			if k := strings.Index(uic, ","); k >= 0 {
+				fdata.Group, uic = uic[:k], uic[k+1:]
+			}
+			fdata.Owner = uic
+			j = k
+		}
+	}
+	if i = indexAfter(buf, "(", j); i != -1 {
+		if j = indexAfter(buf, ")", i); j != -1 {
+			fdata.Protection = buf[i+1 : j]
+			fdata.Mode = vmsMode(fdata.Protection) | entryTypeMode[fdata.Type]
+		}
+	}
 	return
 	
 }
 
-func parseMSDOS(buf string) (fdata *FTPListData) {
+func (p *Parser) parseMSDOS(buf string) (fdata *FTPListData) {
 
 	/*
 
@@ -515,114 +1133,239 @@ func parseMSDOS(buf string) (fdata *FTPListData) {
 	07-18-00  10:16AM       <DIR>          pub
 	04-14-00  03:47PM                  589 readme.htm
 
+	and the variants of IIS, with four-digit or ISO dates, 24-hour
+	times and thousands separators:
+	04-27-2023  21:09               1,234,567 big.iso
+	2023-04-27  21:09       <DIR>          pub
+	2023-04-27  09:09 PM    <JUNCTION>     Application Data [C:\Users\ftp\AppData]
+	2023-04-27  21:09       <SYMLINKD>     latest [releases\1.2]
+
 	*/
 
 	fdata = newFTPListData(buf)
 	buf = strings.Trim(buf, "\t\n\r ")
 
-	var month time.Month = 1
-	var mday int = 0
-	var hour int = 0
-	var minute int = 0
-	var year int = 0
-
-	buflen := len(buf)
 	i := 0
-	j := 0
-
-	if j = indexAfter(buf, "-", j); j == -1 {
-		return
+	next := func() string {
+		for i < len(buf) && buf[i] == ' ' {
+			i++
+		}
+		start := i
+		for i < len(buf) && buf[i] != ' ' {
+			i++
+		}
+		return buf[start:i]
 	}
-	month = time.Month(parseInt(buf[i:j]))
 
-	if j = skip(buf, j, '-'); j == -1 {
-		return
+	year, month, mday, ok := parseDOSDate(next())
+	if !ok {
+		return nil
 	}
-	i = j
-	if j = indexAfter(buf, "-", j); j == -1 {
-		return
+	clock := next()
+	if ampm := next(); ampm == "AM" || ampm == "PM" {
+		clock += ampm
+	} else {
+		i -= len(ampm)
+	}
+	hour, minute, ok := parseDOSTime(clock)
+	if !ok {
+		return nil
 	}
-	mday = parseInt(buf[i:j])
 
-	if j = skip(buf, j, '-'); j == -1 {
-		return
+	switch marker := next(); marker {
+	case "<DIR>":
+		fdata.TryCwd = true
+		fdata.Type = DIR_ENTRY_TYPE
+	case "<JUNCTION>", "<SYMLINKD>":
+		fdata.TryCwd = true
+		fdata.Type = LINK_ENTRY_TYPE
+	case "<SYMLINK>":
+		fdata.TryRetr = true
+		fdata.Type = LINK_ENTRY_TYPE
+	default:
+		size, err := strconv.ParseUint(strings.NewReplacer(",", "", ".", "", "'", "").Replace(marker), 10, 64)
+		if err != nil {
+			return nil
+		}
+		fdata.Size = size
+		fdata.TryRetr = true
+		fdata.Type = FILE_ENTRY_TYPE
 	}
-	i = j
-	if j = indexAfter(buf, " ", j); j == -1 {
+
+	for i < len(buf) && buf[i] == ' ' {
+		i++
+	}
+	fdata.Name = buf[i:]
+	if fdata.Type == LINK_ENTRY_TYPE && strings.HasSuffix(fdata.Name, "]") {
+		if k := strings.LastIndex(fdata.Name, " ["); k > 0 {
+			fdata.LinkDest = fdata.Name[k+2 : len(fdata.Name)-1]
+			fdata.Name = fdata.Name[:k]
+		}
+	}
+	if fdata.Name == "" {
+		return nil
+	}
+	fdata.MtimeType = REMOTE_MINUTE_MTIME_TYPE
+	fdata.Mtime = time.Unix(p.getMtime(year, month, mday, hour, minute, 0), 0)
+	return
+}
+
+// parseDOSDate parses the date of a DOS listing: MM-DD-YY, MM-DD-YYYY or
+// YYYY-MM-DD, with '-' or '/' separators.
+func parseDOSDate(date string) (year int, month time.Month, mday int, ok bool) {
+	parts := strings.FieldsFunc(date, func(r rune) bool { return r == '-' || r == '/' })
+	if len(parts) != 3 {
 		return
 	}
-	year = parseInt(buf[i:j])
-	if year < 50 {
-		year += 2000
+	var n [3]int
+	for k, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil || v < 0 {
+			return
+		}
+		n[k] = v
 	}
-	if year < 1000 {
-		year += 1900
+	if len(parts[0]) == 4 {
+		year, month, mday = n[0], time.Month(n[1]), n[2]
+	} else {
+		month, mday, year = time.Month(n[0]), n[1], n[2]
+		if len(parts[2]) <= 2 {
+			if year < 50 {
+				year += 2000
+			} else {
+				year += 1900
+			}
+		}
 	}
+	ok = month >= 1 && month <= 12 && mday >= 1 && mday <= 31
+	return
+}
 
-	if j = skip(buf, j, ' '); j == -1 {
+// parseDOSTime parses the time of a DOS listing, as "09:09PM" or "21:09",
+// with optional seconds.
+func parseDOSTime(clock string) (hour, minute int, ok bool) {
+	ampm := ""
+	if strings.HasSuffix(clock, "AM") || strings.HasSuffix(clock, "PM") {
+		clock, ampm = clock[:len(clock)-2], clock[len(clock)-2:]
+	}
+	parts := strings.Split(clock, ":")
+	if len(parts) < 2 || len(parts) > 3 {
 		return
 	}
-	i = j
-	if j = indexAfter(buf, ":", j); j == -1 {
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil {
 		return
 	}
-	hour = parseInt(buf[i:j])
-	if j = skip(buf, j, ':'); j == -1 {
+	if minute, err = strconv.Atoi(parts[1]); err != nil {
 		return
 	}
-	i = j
-	for (buf[j] != 'A') && (buf[j] != 'P') {
-		j += 1
-		if j == buflen {
+	switch ampm {
+	case "AM", "PM":
+		if hour < 1 || hour > 12 {
 			return
 		}
+		hour %= 12
+		if ampm == "PM" {
+			hour += 12
+		}
 	}
+	ok = hour >= 0 && hour < 24 && minute >= 0 && minute < 60
+	return
+}
 
-	minute = parseInt(buf[i:j])
 
-	if buf[j] == 'A' {
-		j += 1
-		if j == buflen {
-			return
-		}
+/*
+ParseMLSxLine parses one entry of an MLSD listing, or the entry line
+of an MLST reply (RFC 3659):
+
+	"type=file;size=531;modify=20230129032600;unique=801g4804045; README"
+	"type=dir;modify=20030408000000; etc"
+
+It returns nil for lines which are not valid entries.
+*/
+func ParseMLSxLine(ftpListLine string) (fdata *FTPListData) {
+	fdata = newFTPListData(ftpListLine)
+	buf := strings.TrimRight(ftpListLine, "\r\n")
+	buf = strings.TrimLeft(buf, " ")
+	i := strings.Index(buf, " ")
+	if i < 0 || i == len(buf)-1 {
+		return nil
 	}
-	if buf[j] == 'P' {
-		hour = (hour + 12) % 24
-		j += 1
-		if j == buflen {
-			return
+	fdata.Name = buf[i+1:]
+	fdata.Facts = make(map[string]string)
+
+	for _, fact := range strings.Split(buf[:i], ";") {
+		j := strings.Index(fact, "=")
+		if j <= 0 {
+			continue
 		}
-	}
-	if buf[j] == 'M' {
-		j += 1
-		if j == buflen {
-			return
+		name, value := strings.ToLower(fact[:j]), fact[j+1:]
+		fdata.Facts[name] = value
+
+		switch name {
+		case "type":
+			switch strings.ToLower(value) {
+			case "dir", "cdir", "pdir":
+				fdata.TryCwd = true
+				fdata.Type = DIR_ENTRY_TYPE
+			case "file":
+				fdata.TryRetr = true
+				fdata.Type = FILE_ENTRY_TYPE
+			default:
+				// e.g. "OS.unix=slink:/usr/bin"
+				if k := strings.Index(strings.ToLower(value), "=slink:"); k > 0 {
+					fdata.TryCwd = true
+					fdata.TryRetr = true
+					fdata.Type = LINK_ENTRY_TYPE
+					fdata.LinkDest = value[k+7:]
+				}
+			}
+		case "size":
+			fdata.Size, _ = strconv.ParseUint(value, 10, 64)
+		case "modify":
+			if t, err := parseMLSxTime(value); err == nil {
+				fdata.MtimeType = LOCAL_MTIME_TYPE
+				fdata.Mtime = t
+			}
+		case "unique":
+			fdata.IdType = FULL_ID_TYPE
+			fdata.Id = value
+		case "unix.mode":
+			if mode, err := strconv.ParseUint(value, 8, 32); err == nil {
+				fdata.Mode = unixMode(uint32(mode))
+			}
+		case "unix.owner":
+			fdata.Owner = value
+		case "unix.group":
+			fdata.Group = value
 		}
 	}
-	if j = skip(buf, j, ' '); j == -1 {
-		return
-	}
-	if buf[j] == '<' {
-		fdata.TryCwd = true
-		if j = indexAfter(buf, " ", j); j == -1 {
-			return
-		}
-	} else {
-		i = j
-		if j = indexAfter(buf, " ", j); j == -1 {
-			return
-		}
-		fdata.Size, _ = strconv.ParseUint(buf[i:j], 10, 64)
-		fdata.TryRetr = true
+	if fdata.Mode != 0 {
+		fdata.Mode |= entryTypeMode[fdata.Type]
 	}
+	return
+}
 
-	if j = skip(buf, j, ' '); j == -1 {
-		return
+// unixMode converts the permission bits of a Unix st_mode, as in the
+// UNIX.mode fact, to an fs.FileMode.
+func unixMode(mode uint32) (m fs.FileMode) {
+	m = fs.FileMode(mode & 0777)
+	if mode&04000 != 0 {
+		m |= fs.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		m |= fs.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		m |= fs.ModeSticky
 	}
-	fdata.Name = buf[j:]
-	fdata.MtimeType = REMOTE_MINUTE_MTIME_TYPE
-	fdata.Mtime = time.Unix(getMtime(year, month, mday, hour, minute, 0), 0)
 	return
 }
 
-
+// parseMLSxTime parses a time-val of RFC 3659, YYYYMMDDHHMMSS[.sss] in UTC.
+func parseMLSxTime(value string) (time.Time, error) {
+	if i := strings.Index(value, "."); i >= 0 {
+		value = value[:i]
+	}
+	return time.ParseInLocation("20060102150405", value, time.UTC)
+}
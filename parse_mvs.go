@@ -0,0 +1,95 @@
+package ftp
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Parsers for the listings of IBM z/OS FTP servers. In the MVS file system,
+LIST prints a header line which tells the kind of the listing:
+
+Datasets of a qualifier:
+
+	"Volume Unit    Referred Ext Used Recfm Lrecl BlkSz Dsorg Dsname"
+	"WYOSPT 3420   2003/03/12  1  150  FB      80  6160  PS  USER.DATA"
+	"WYOSPT 3390   2003/03/12  2  225  VB   27994 27998  PO  USER.PDS"
+	"Migrated                                                 USER.OLD"
+	"Pseudo Directory                                         USER.SUB"
+
+Members of a partitioned dataset (PDS):
+
+	" Name     VV.MM   Created       Changed      Size  Init   Mod   Id"
+	"MEMBER1   01.03 2002/09/12 2002/09/12 10:49    57    57     0 USER"
+	"MEMBER2"
+
+The Unix System Services file system is listed as by UNIX ls, which
+ParseLine handles. Unless the Format of the Parser is set, the header is
+needed and datasets and members are only recognized by ParseListing.
+*/
+
+// parseMVSDataset parses a line of a listing of datasets. The Used column
+// counts tracks, so Size is not known.
+func (p *Parser) parseMVSDataset(buf string) *FTPListData {
+	fields := strings.Fields(buf)
+	if len(fields) == 0 {
+		return nil
+	}
+	fdata := newFTPListData(buf)
+	fdata.Name = fields[len(fields)-1]
+
+	switch {
+	case len(fields) == 10:
+		if t, err := time.ParseInLocation("2006/01/02", fields[2], p.location()); err == nil {
+			fdata.MtimeType = REMOTE_DAY_MTIME_TYPE
+			fdata.Mtime = t
+		}
+		fdata.Recfm = fields[5]
+		fdata.Lrecl, _ = strconv.Atoi(fields[6])
+		fdata.BlkSz, _ = strconv.Atoi(fields[7])
+		fdata.Dsorg = fields[8]
+	case fields[0] == "Pseudo":
+		// a qualifier shared by several datasets
+		fdata.TryCwd = true
+		fdata.Type = DIR_ENTRY_TYPE
+		return fdata
+	case len(fields) == 2 && fields[0] == "VSAM":
+		fdata.Dsorg = fields[0]
+	}
+
+	// partitioned datasets are entered with CWD, their members retrieved
+	if strings.HasPrefix(fdata.Dsorg, "PO") {
+		fdata.TryCwd = true
+		fdata.Type = DIR_ENTRY_TYPE
+	} else {
+		fdata.TryRetr = true
+		fdata.Type = FILE_ENTRY_TYPE
+	}
+	return fdata
+}
+
+// parseMVSMember parses a line of a listing of the members of a PDS. The
+// Size column counts records, so Size is not known.
+func (p *Parser) parseMVSMember(buf string) *FTPListData {
+	fields := strings.Fields(buf)
+	if len(fields) == 0 {
+		return nil
+	}
+	fdata := newFTPListData(buf)
+	fdata.Name = fields[0]
+	fdata.TryRetr = true
+	fdata.Type = FILE_ENTRY_TYPE
+
+	if len(fields) >= 5 {
+		changed := fields[3] + " " + fields[4]
+		if t, err := time.ParseInLocation("2006/01/02 15:04", changed, p.location()); err == nil {
+			fdata.MtimeType = REMOTE_MINUTE_MTIME_TYPE
+			fdata.Mtime = t
+		}
+	}
+	if len(fields) == 9 {
+		fdata.Owner = fields[8]
+	}
+	return fdata
+}
@@ -0,0 +1,78 @@
+package ftp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMVSDatasets(t *testing.T) {
+	listing := "Volume Unit    Referred Ext Used Recfm Lrecl BlkSz Dsorg Dsname\r\n" +
+		"WYOSPT 3420   2003/03/12  1  150  FB      80  6160  PS  USER.DATA\r\n" +
+		"WYOSPT 3390   2003/03/12  2  225  VB   27994 27998  PO  USER.PDS\r\n" +
+		"Migrated                                                 USER.OLD\r\n" +
+		"Pseudo Directory                                         USER.SUB\r\n"
+	entries, err := defaultParser.ParseListing(strings.NewReader(listing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("ParseListing = %d entries, want 4", len(entries))
+	}
+
+	e := entries[0]
+	if e.Name != "USER.DATA" || !e.TryRetr || e.TryCwd {
+		t.Errorf("dataset = %+v", e)
+	}
+	if e.Recfm != "FB" || e.Lrecl != 80 || e.BlkSz != 6160 || e.Dsorg != "PS" {
+		t.Errorf("dataset recfm, lrecl, blksz, dsorg = %q, %v, %v, %q", e.Recfm, e.Lrecl, e.BlkSz, e.Dsorg)
+	}
+	if e.MtimeType != REMOTE_DAY_MTIME_TYPE || !e.Mtime.Equal(time.Date(2003, 3, 12, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("dataset mtime = %v", e.Mtime)
+	}
+
+	if e = entries[1]; e.Name != "USER.PDS" || !e.TryCwd || e.TryRetr || e.Dsorg != "PO" || e.Lrecl != 27994 {
+		t.Errorf("PDS = %+v", e)
+	}
+	if e = entries[2]; e.Name != "USER.OLD" || !e.TryRetr {
+		t.Errorf("migrated dataset = %+v", e)
+	}
+	if e = entries[3]; e.Name != "USER.SUB" || !e.TryCwd || e.Type != DIR_ENTRY_TYPE {
+		t.Errorf("pseudo directory = %+v", e)
+	}
+}
+
+func TestParseMVSMembers(t *testing.T) {
+	listing := " Name     VV.MM   Created       Changed      Size  Init   Mod   Id\r\n" +
+		"MEMBER1   01.03 2002/09/12 2002/09/13 10:49    57    57     0 USER\r\n" +
+		"MEMBER2\r\n"
+	entries, err := defaultParser.ParseListing(strings.NewReader(listing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("ParseListing = %d entries, want 2", len(entries))
+	}
+	e := entries[0]
+	if e.Name != "MEMBER1" || !e.TryRetr || e.Owner != "USER" {
+		t.Errorf("member = %+v", e)
+	}
+	if !e.Mtime.Equal(time.Date(2002, 9, 13, 10, 49, 0, 0, time.UTC)) {
+		t.Errorf("member mtime = %v", e.Mtime)
+	}
+	if e = entries[1]; e.Name != "MEMBER2" || !e.TryRetr {
+		t.Errorf("member = %+v", e)
+	}
+}
+
+func TestParseUSS(t *testing.T) {
+	listing := "total 24\r\n" +
+		"-rwxr-xr-x   2 OMVSKERN SYS1        8192 Jun 30  2009 run.sh\r\n"
+	entries, err := defaultParser.ParseListing(strings.NewReader(listing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != "run.sh" || entries[0].Owner != "OMVSKERN" || entries[0].Size != 8192 {
+		t.Errorf("ParseListing = %+v", entries)
+	}
+}
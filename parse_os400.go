@@ -0,0 +1,93 @@
+package ftp
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Parser for the listings of IBM i (OS/400) FTP servers, which list objects
+with their owner, size, date and type:
+
+	"QSYS            77824 04/03/24 12:46:18 *DIR       /"
+	"PEP              4019 04/03/18 18:58:16 *STMF      file.txt"
+	"PEP             12288 04/03/18 18:58:16 *FILE      MYFILE.FILE"
+	"PEP                                     *MEM       MYFILE.FILE/MEMBER.MBR"
+
+Members have neither size nor date. The date is YY/MM/DD, or MM/DD/YY on
+some systems.
+*/
+
+// isOS400 reports whether buf looks like a line of an OS/400 listing,
+// with an object type in the fifth column, or the second for members.
+func isOS400(buf string) bool {
+	fields := strings.Fields(buf)
+	return (len(fields) >= 6 && isOS400Type(fields[4])) ||
+		(len(fields) >= 3 && isOS400Type(fields[1]))
+}
+
+// isOS400Type reports whether s is an object type, as "*STMF".
+func isOS400Type(s string) bool {
+	if len(s) < 2 || s[0] != '*' {
+		return false
+	}
+	return strings.Trim(s[1:], "ABCDEFGHIJKLMNOPQRSTUVWXYZ") == ""
+}
+
+func (p *Parser) parseOS400(buf string) *FTPListData {
+	fields := strings.Fields(buf)
+	var typ string
+	dated := false
+	switch {
+	case len(fields) >= 6 && isOS400Type(fields[4]):
+		typ, dated = fields[4], true
+	case len(fields) >= 3 && isOS400Type(fields[1]):
+		typ = fields[1]
+	default:
+		return nil
+	}
+
+	fdata := newFTPListData(buf)
+	fdata.Owner = fields[0]
+	// the owner, size and date have no '*', so the first one starts the type
+	k := strings.IndexByte(buf, '*') + len(typ)
+	fdata.Name = strings.TrimSpace(buf[k:])
+
+	if dated {
+		fdata.Size, _ = strconv.ParseUint(fields[1], 10, 64)
+		stamp := fields[2] + " " + fields[3]
+		for _, layout := range []string{"06/01/02 15:04:05", "01/02/06 15:04:05"} {
+			if t, err := time.ParseInLocation(layout, stamp, p.location()); err == nil {
+				fdata.MtimeType = REMOTE_MINUTE_MTIME_TYPE
+				fdata.Mtime = t
+				break
+			}
+		}
+	}
+
+	switch typ {
+	case "*DIR", "*LIB", "*FLR":
+		fdata.TryCwd = true
+		fdata.Type = DIR_ENTRY_TYPE
+	case "*FILE":
+		// a database file holds members, but may be retrieved as a whole
+		fdata.TryCwd = true
+		fdata.TryRetr = true
+		fdata.Type = DIR_ENTRY_TYPE
+	case "*SYMLNK":
+		fdata.TryCwd = true
+		fdata.TryRetr = true
+		fdata.Type = LINK_ENTRY_TYPE
+	default:
+		fdata.TryRetr = true
+		fdata.Type = FILE_ENTRY_TYPE
+	}
+	if len(fdata.Name) > 1 && strings.HasSuffix(fdata.Name, "/") {
+		fdata.Name = fdata.Name[:len(fdata.Name)-1]
+	}
+	if fdata.Name == "" {
+		return nil
+	}
+	return fdata
+}
@@ -0,0 +1,42 @@
+package ftp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseOS400(t *testing.T) {
+	tests := []struct {
+		line   string
+		name   string
+		owner  string
+		size   uint64
+		typ    ENTRY_TYPE
+		tryCwd bool
+		mtime  time.Time
+	}{
+		{"QSYS            77824 04/03/24 12:46:18 *DIR       /",
+			"/", "QSYS", 77824, DIR_ENTRY_TYPE, true, time.Date(2004, 3, 24, 12, 46, 18, 0, time.UTC)},
+		{"PEP              4019 04/03/18 18:58:16 *STMF      my file.txt",
+			"my file.txt", "PEP", 4019, FILE_ENTRY_TYPE, false, time.Date(2004, 3, 18, 18, 58, 16, 0, time.UTC)},
+		{"PEP             12288 12/31/04 18:58:16 *FILE      MYFILE.FILE/",
+			"MYFILE.FILE", "PEP", 12288, DIR_ENTRY_TYPE, true, time.Date(2004, 12, 31, 18, 58, 16, 0, time.UTC)},
+		{"PEP                                     *MEM       MYFILE.FILE/MEMBER.MBR",
+			"MYFILE.FILE/MEMBER.MBR", "PEP", 0, FILE_ENTRY_TYPE, false, time.Time{}},
+	}
+	for _, tt := range tests {
+		for _, p := range []*Parser{defaultParser, {Format: OS400_LIST_FORMAT}} {
+			e := p.ParseLine(tt.line)
+			if e == nil {
+				t.Errorf("ParseLine(%v) = nil", tt.line)
+				continue
+			}
+			if e.Name != tt.name || e.Owner != tt.owner || e.Size != tt.size || e.Type != tt.typ || e.TryCwd != tt.tryCwd {
+				t.Errorf("ParseLine(%v) = %+v", tt.line, e)
+			}
+			if !e.Mtime.Equal(tt.mtime) {
+				t.Errorf("ParseLine(%v).mtime = %v, want %v", tt.line, e.Mtime, tt.mtime)
+			}
+		}
+	}
+}
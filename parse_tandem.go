@@ -0,0 +1,62 @@
+package ftp
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Parser for the listings of HP NonStop (Tandem) Guardian FTP servers,
+which follow a header line:
+
+	"File         Code             EOF  Last Modification    Owner  RWEP"
+	"ALTERCAT      101              1 15-Sep-11 11:28:13 255, 0 \"oooo\""
+	"ZBBDEFS         0          34536 23-Oct-10 16:30:56 200,254 \"NUNU\""
+
+The EOF is the size of the file in bytes. The owner is a group and user
+number, and RWEP the security of the file for reading, writing, executing
+and purging.
+*/
+
+func (p *Parser) parseTandem(buf string) *FTPListData {
+	fields := strings.Fields(buf)
+	if len(fields) < 6 {
+		return nil
+	}
+	code, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil
+	}
+	size, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil {
+		return nil
+	}
+	mtime, err := time.ParseInLocation("2-Jan-06 15:04:05", fields[3]+" "+fields[4], p.location())
+	if err != nil {
+		return nil
+	}
+
+	fdata := newFTPListData(buf)
+	fdata.Name = fields[0]
+	fdata.FileCode = code
+	fdata.Size = size
+	fdata.MtimeType = REMOTE_MINUTE_MTIME_TYPE
+	fdata.Mtime = mtime
+	fdata.TryRetr = true
+	fdata.Type = FILE_ENTRY_TYPE
+
+	// the owner may hold a space, as "255, 0", so it is taken up to RWEP
+	rest := buf[strings.Index(buf, fields[4])+len(fields[4]):]
+	owner := rest
+	if q := strings.IndexByte(rest, '"'); q >= 0 {
+		owner = rest[:q]
+		fdata.Protection = strings.Trim(rest[q:], "\" \t\r\n")
+	}
+	owner = strings.Join(strings.Fields(owner), "")
+	if k := strings.IndexByte(owner, ','); k >= 0 {
+		fdata.Group, owner = owner[:k], owner[k+1:]
+	}
+	fdata.Owner = owner
+	return fdata
+}
@@ -0,0 +1,40 @@
+package ftp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTandem(t *testing.T) {
+	listing := "File         Code             EOF  Last Modification    Owner  RWEP\r\n" +
+		"ALTERCAT      101              1 15-Sep-11 11:28:13 255, 0 \"oooo\"\r\n" +
+		"ZBBDEFS         0          34536 23-Oct-10 16:30:56 200,254 \"NUNU\"\r\n"
+	entries, err := defaultParser.ParseListing(strings.NewReader(listing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("ParseListing = %d entries, want 2", len(entries))
+	}
+
+	e := entries[0]
+	if e.Name != "ALTERCAT" || e.FileCode != 101 || e.Size != 1 || !e.TryRetr {
+		t.Errorf("entry = %+v", e)
+	}
+	if e.Group != "255" || e.Owner != "0" || e.Protection != "oooo" {
+		t.Errorf("entry group, owner, protection = %q, %q, %q", e.Group, e.Owner, e.Protection)
+	}
+	if !e.Mtime.Equal(time.Date(2011, 9, 15, 11, 28, 13, 0, time.UTC)) {
+		t.Errorf("entry mtime = %v", e.Mtime)
+	}
+
+	p := &Parser{Format: TANDEM_LIST_FORMAT}
+	e = p.ParseLine("ZBBDEFS         0          34536 23-Oct-10 16:30:56 200,254 \"NUNU\"")
+	if e == nil || e.Name != "ZBBDEFS" || e.Size != 34536 || e.Group != "200" || e.Owner != "254" || e.Protection != "NUNU" {
+		t.Errorf("ParseLine = %+v", e)
+	}
+	if e = p.ParseLine("-rw-r--r--   1 root     other     531 Jan 29 03:26 README"); e != nil {
+		t.Errorf("ParseLine(unix) = %+v, want nil", e)
+	}
+}
@@ -1,6 +1,8 @@
 package ftp
 
 import (
+	"io/fs"
+	"strings"
 	"testing"
 	"time"
 )
@@ -16,6 +18,8 @@ type line struct {
 
 var l, _ = time.LoadLocation("UTC")
 
+var currentYear = time.Now().Year()
+
 var yr =  map[bool]int{ true: currentYear, false: currentYear-1 }
 
 var listTests = []line{
@@ -44,11 +48,11 @@ var listTests = []line{
 		2, time.Date(1996, 5, 10, 0, 0, 0, 0, l), "bar.sit", true},
 
 	line{"CORE.DIR;1      1 8-NOV-1999 07:02 [SYSTEM] (RWED,RWED,RE,RE)", "MultiNet/VMS",
-		0, time.Date(1999, 11, 8, 7, 2, 0, 0, l), "CORE", true},
+		512, time.Date(1999, 11, 8, 7, 2, 0, 0, l), "CORE", true},
 	line{"00README.TXT;1      2 30-DEC-1976 17:44 [SYSTEM] (RWED,RWED,RE,RE)", "MultiNet/VMS",
-		0, time.Date(1976, 12, 30, 17, 44, 0, 0, l), "00README.TXT", false},
+		1024, time.Date(1976, 12, 30, 17, 44, 0, 0, l), "00README.TXT", false},
 	line{"CII-MANUAL.TEX;1  213/216  29-JAN-1996 03:33:12  [ANONYMOU,ANONYMOUS]   (RWED,RWED,,)", "MultiNet/VMS",
-		0, time.Date(1996, 1, 29, 03, 33, 0, 0, l), "CII-MANUAL.TEX", false}, // Doesn't parse the seconds
+		109056, time.Date(1996, 1, 29, 03, 33, 0, 0, l), "CII-MANUAL.TEX", false}, // Doesn't parse the seconds
 	
 	line{"04-27-00  09:09PM       <DIR>          licensed", "MS-DOS",
 		0, time.Date(2000, 4, 27, 21, 9, 0, 0, l), "licensed", true},
@@ -56,6 +60,12 @@ var listTests = []line{
 		0, time.Date(2003, 11, 18, 10, 16, 0, 0, l), "pub", true},
 	line{"04-14-99  03:47PM                  589 readme.htm", "MS-DOS",
 		589, time.Date(1999, 04, 14, 15, 47, 0, 0, l), "readme.htm", false},
+	line{"04-27-2023  21:09               1,234,567 big file.iso", "IIS",
+		1234567, time.Date(2023, 4, 27, 21, 9, 0, 0, l), "big file.iso", false},
+	line{"2023-04-27  12:05AM       <DIR>          pub", "IIS",
+		0, time.Date(2023, 4, 27, 0, 5, 0, 0, l), "pub", true},
+	line{"2023/04/27  12:05 PM                1.024 noon.txt", "IIS",
+		1024, time.Date(2023, 4, 27, 12, 5, 0, 0, l), "noon.txt", false},
 
 }
 
@@ -76,3 +86,269 @@ func TestParseListLine(t *testing.T) {
 		}
 	}
 }
+
+var unixDetailTests = []struct {
+	line  string
+	typ   ENTRY_TYPE
+	mode  fs.FileMode
+	nlink int
+	owner string
+	group string
+}{
+	{"-rw-r--r--   1 root     other     531 Jan 29 03:26 README",
+		FILE_ENTRY_TYPE, 0644, 1, "root", "other"},
+	{"dr-xr-xr-x   2 root     512 Apr  8  2003 etc",
+		DIR_ENTRY_TYPE, fs.ModeDir | 0555, 2, "root", ""},
+	{"lrwxrwxrwx   1 root     other          7 Jan 25 00:17 bin -> usr/bin",
+		LINK_ENTRY_TYPE, fs.ModeSymlink | 0777, 1, "root", "other"},
+	{"-rwsr-sr-x+  1 root     wheel      53216 Jan 25 00:17 passwd",
+		FILE_ENTRY_TYPE, fs.ModeSetuid | fs.ModeSetgid | 0755, 1, "root", "wheel"},
+	{"drwxrwxrwt  12 root     root        4096 Jan 25 00:17 tmp",
+		DIR_ENTRY_TYPE, fs.ModeDir | fs.ModeSticky | 0777, 12, "root", "root"},
+	{"-rwSr--r-T   1 ftp      ftp            0 Jan 25 00:17 odd",
+		FILE_ENTRY_TYPE, fs.ModeSetuid | fs.ModeSticky | 0644, 1, "ftp", "ftp"},
+	{"brw-rw----   1 root     disk      8,   0 Jan 25 00:17 sda",
+		BLOCK_DEVICE_ENTRY_TYPE, fs.ModeDevice | 0660, 1, "root", "disk"},
+	{"crw-rw-rw-   1 root     root      1,   3 Jan 25 00:17 null",
+		CHAR_DEVICE_ENTRY_TYPE, fs.ModeDevice | fs.ModeCharDevice | 0666, 1, "root", "root"},
+	{"prw-------   1 ftp      ftp            0 Jan 25 00:17 fifo",
+		PIPE_ENTRY_TYPE, fs.ModeNamedPipe | 0600, 1, "ftp", "ftp"},
+	{"srwxrwxrwx   1 ftp      ftp            0 Jan 25 00:17 sock",
+		SOCKET_ENTRY_TYPE, fs.ModeSocket | 0777, 1, "ftp", "ftp"},
+	{"d [R----F--] supervisor    512    Jan 16 18:53    login",
+		DIR_ENTRY_TYPE, 0, 0, "supervisor", ""},
+}
+
+func TestParseUnixDetails(t *testing.T) {
+	for _, lt := range unixDetailTests {
+		entry := ParseLine(lt.line)
+		if entry == nil {
+			t.Errorf("ParseLine(%v) = nil", lt.line)
+			continue
+		}
+		if entry.Type != lt.typ || entry.Mode != lt.mode {
+			t.Errorf("ParseLine(%v) type, mode = %v, %v, want %v, %v", lt.line, entry.Type, entry.Mode, lt.typ, lt.mode)
+		}
+		if entry.Nlink != lt.nlink || entry.Owner != lt.owner || entry.Group != lt.group {
+			t.Errorf("ParseLine(%v) nlink, owner, group = %v, %q, %q, want %v, %q, %q",
+				lt.line, entry.Nlink, entry.Owner, entry.Group, lt.nlink, lt.owner, lt.group)
+		}
+	}
+}
+
+func TestParseUnixInode(t *testing.T) {
+	entry := ParseLine(" 1523264    8 -rw-r--r--   2 root     other        531 Jan 29 03:26 README")
+	if entry == nil || entry.Name != "README" || entry.Size != 531 || entry.Nlink != 2 {
+		t.Fatalf("ParseLine = %+v", entry)
+	}
+	if entry.IdType != FULL_ID_TYPE || entry.Id != "1523264" {
+		t.Errorf("ParseLine.id = %v '%v', want FULL '1523264'", entry.IdType, entry.Id)
+	}
+
+	entry = ParseLine("8 drwxr-xr-x   2 root     other       4096 Apr  8  2003 etc")
+	if entry == nil || entry.Name != "etc" || !entry.TryCwd || entry.IdType != UNKNOWN_ID_TYPE {
+		t.Errorf("ParseLine = %+v", entry)
+	}
+
+	entry = ParseLine("04-14-99  03:47PM                  589 readme.htm")
+	if entry == nil || entry.Name != "readme.htm" || entry.Size != 589 {
+		t.Errorf("ParseLine = %+v", entry)
+	}
+}
+
+func TestParseListing(t *testing.T) {
+	listing := "Directory USER1:[ANONYMOUS]\r\n" +
+		"\r\n" +
+		"A_VERY_LONG_FILE_NAME_INDEED.TXT;12\r\n" +
+		"                   213/216  29-JAN-1996 03:33:12  [ANONYMOU,ANONYMOUS]   (RWED,RWED,,)\r\n" +
+		"CORE.DIR;1          1  8-SEP-1996 16:09 [SYSTEM] (RWE,RWE,RE,RE)\r\n" +
+		"\r\n" +
+		"Total of 2 files, 214/217 blocks.\r\n"
+	p := &Parser{BlockSize: 1024}
+	entries, err := p.ParseListing(strings.NewReader(listing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("ParseListing = %d entries, want 2", len(entries))
+	}
+
+	e := entries[0]
+	if e.Name != "A_VERY_LONG_FILE_NAME_INDEED.TXT" || e.Size != 213*1024 || !e.TryRetr {
+		t.Errorf("ParseListing[0] = %+v", e)
+	}
+	if !e.Mtime.Equal(time.Date(1996, 1, 29, 3, 33, 0, 0, time.UTC)) {
+		t.Errorf("ParseListing[0].mtime = %v", e.Mtime)
+	}
+	if e.Owner != "ANONYMOUS" || e.Group != "ANONYMOU" || e.Protection != "RWED,RWED,," || e.Mode != 0700 {
+		t.Errorf("ParseListing[0] owner, group, protection, mode = %q, %q, %q, %v",
+			e.Owner, e.Group, e.Protection, e.Mode)
+	}
+
+	e = entries[1]
+	if e.Name != "CORE" || !e.TryCwd || e.Size != 1024 || e.Owner != "SYSTEM" || e.Group != "" {
+		t.Errorf("ParseListing[1] = %+v", e)
+	}
+	if e.Mode != fs.ModeDir|0755 {
+		t.Errorf("ParseListing[1].mode = %v", e.Mode)
+	}
+}
+
+func TestParseEPLF(t *testing.T) {
+	entry := ParseLine("+i8388621.44468,m839956783,r,s10376,up644,xyz,\tRFC EPLF\r\n")
+	if entry == nil {
+		t.Fatal("ParseLine returned nil")
+	}
+	if entry.Name != "RFC EPLF" || entry.Size != 10376 || !entry.TryRetr || entry.TryCwd || entry.Type != FILE_ENTRY_TYPE {
+		t.Errorf("ParseLine = %+v", entry)
+	}
+	if entry.IdType != FULL_ID_TYPE || entry.Id != "8388621.44468" {
+		t.Errorf("ParseLine.id = '%v'", entry.Id)
+	}
+	if !entry.Mtime.Equal(time.Unix(839956783, 0)) || entry.Mode != 0644 {
+		t.Errorf("ParseLine mtime, mode = %v, %v", entry.Mtime, entry.Mode)
+	}
+	if entry.Facts["x"] != "yz" || entry.Facts["up"] != "644" || entry.Facts["s"] != "10376" {
+		t.Errorf("ParseLine.facts = %v", entry.Facts)
+	}
+
+	for _, bad := range []string{"+i8388621.29609,m824255902,/,dev", "+s12x,\tfoo", "+m-,\tfoo", "+up9,\tfoo", "+/,\t"} {
+		if entry, err := parseEPLF(bad); err == nil {
+			t.Errorf("parseEPLF(%q) = %+v, want an error", bad, entry)
+		}
+	}
+}
+
+// FuzzParseLine checks that no parser panics, whatever the line.
+func FuzzParseLine(f *testing.F) {
+	for _, lt := range listTests {
+		f.Add(lt.line)
+	}
+	for _, lt := range unixDetailTests {
+		f.Add(lt.line)
+	}
+	f.Add("+i8388621.44468,m839956783,r,s10376,up644,\tRFCEPLF")
+	f.Add("type=file;size=531;modify=20030408123456; README")
+	f.Add(" 1523264    8 -rw-r--r--   2 root     other        531 Jan 29 03:26 README")
+	f.Add("0 brwxr-xr-x ")
+	f.Add("WYOSPT 3420   2003/03/12  1  150  FB      80  6160  PS  USER.DATA")
+	f.Add("PEP              4019 04/03/18 18:58:16 *STMF      file.txt")
+	f.Add("ALTERCAT      101              1 15-Sep-11 11:28:13 255, 0 \"oooo\"")
+
+	f.Fuzz(func(t *testing.T, line string) {
+		ParseLine(line)
+		if entry, err := defaultParser.Parse(line); (entry == nil) == (err == nil) {
+			t.Errorf("Parse(%q) = %+v, %v", line, entry, err)
+		} else if entry != nil && entry.Name == "" {
+			t.Errorf("Parse(%q) = %+v, without a name", line, entry)
+		}
+		ParseMLSxLine(line)
+		for format := EPLF_LIST_FORMAT; format <= TANDEM_LIST_FORMAT; format++ {
+			defaultParser.parseFormat(format, line)
+		}
+		defaultParser.ParseListing(strings.NewReader(line))
+	})
+}
+
+func TestParseResults(t *testing.T) {
+	for _, line := range []string{"total 42", "", "  \r\n", "Total of 2 files, 214/217 blocks.",
+		"Directory USER1:[ANONYMOUS]", "Volume Unit    Referred Ext Used Recfm Lrecl BlkSz Dsorg Dsname",
+		"               2 File(s)          1,234 bytes"} {
+		if entry, err := defaultParser.Parse(line); err != ErrSkipLine {
+			t.Errorf("Parse(%q) = %+v, %v, want ErrSkipLine", line, entry, err)
+		}
+	}
+
+	for _, line := range []string{"garbage", "-rw-r--r--   1 root     other        531 Jan", "04-27-00  09:09PM",
+		"CORE.DIR;1          1  8-SEP-1996", "+i8388621.29609,m824255902,/,dev"} {
+		entry, err := defaultParser.Parse(line)
+		if _, ok := err.(*ParseError); !ok || entry != nil {
+			t.Errorf("Parse(%q) = %+v, %v, want a ParseError", line, entry, err)
+		}
+		if entry = ParseLine(line); entry != nil {
+			t.Errorf("ParseLine(%q) = %+v, want nil", line, entry)
+		}
+	}
+
+	_, err := defaultParser.Parse("+s12x,\tfoo")
+	if pe, ok := err.(*ParseError); !ok || pe.Format != EPLF_LIST_FORMAT || pe.Err == ErrUnrecognized {
+		t.Errorf("Parse(bad EPLF) = %v, want the EPLF error", err)
+	}
+}
+
+func TestParseMSDOSLinks(t *testing.T) {
+	entry := ParseLine(`2023-04-27  09:09 PM    <JUNCTION>     Application Data [C:\Users\ftp\AppData]`)
+	if entry == nil || entry.Name != "Application Data" || entry.LinkDest != `C:\Users\ftp\AppData` {
+		t.Fatalf("ParseLine = %+v", entry)
+	}
+	if entry.Type != LINK_ENTRY_TYPE || !entry.TryCwd || !entry.Mtime.Equal(time.Date(2023, 4, 27, 21, 9, 0, 0, time.UTC)) {
+		t.Errorf("ParseLine = %+v", entry)
+	}
+
+	entry = ParseLine(`04-27-23  21:09       <SYMLINKD>     latest [releases\1.2]`)
+	if entry == nil || entry.Name != "latest" || entry.LinkDest != `releases\1.2` || entry.Type != LINK_ENTRY_TYPE {
+		t.Errorf("ParseLine = %+v", entry)
+	}
+
+	for _, bad := range []string{"13-27-2023  21:09  12 x", "04-27-2023  25:09  12 x", "04-27-2023  13:09PM  12 x", "04-27-2023  21:09  1x2 x"} {
+		if entry = ParseLine(bad); entry != nil {
+			t.Errorf("ParseLine(%q) = %+v, want nil", bad, entry)
+		}
+	}
+}
+
+func TestParseMLSxLine(t *testing.T) {
+	entry := ParseMLSxLine("type=file;size=531;modify=20030408123456.789;unique=801g48; README\r\n")
+	if entry == nil {
+		t.Fatal("ParseMLSxLine returned nil")
+	}
+	if entry.Name != "README" || entry.Size != 531 || entry.TryCwd || !entry.TryRetr {
+		t.Errorf("ParseMLSxLine = %+v", entry)
+	}
+	if !entry.Mtime.Equal(time.Date(2003, 4, 8, 12, 34, 56, 0, time.UTC)) {
+		t.Errorf("ParseMLSxLine.mtime = %v", entry.Mtime)
+	}
+	if entry.IdType != FULL_ID_TYPE || entry.Id != "801g48" {
+		t.Errorf("ParseMLSxLine.id = '%v'", entry.Id)
+	}
+
+	entry = ParseMLSxLine("type=dir;UNIX.mode=1777;UNIX.owner=root;UNIX.group=wheel; tmp")
+	if entry == nil || entry.Type != DIR_ENTRY_TYPE || entry.Mode != fs.ModeDir|fs.ModeSticky|0777 ||
+		entry.Owner != "root" || entry.Group != "wheel" {
+		t.Errorf("ParseMLSxLine = %+v", entry)
+	}
+
+	entry = ParseMLSxLine("type=OS.unix=slink:/usr/bin;modify=20030408000000; bin")
+	if entry == nil || entry.Name != "bin" || entry.LinkDest != "/usr/bin" {
+		t.Errorf("ParseMLSxLine = %+v", entry)
+	}
+
+	if entry = ParseMLSxLine("garbage"); entry != nil {
+		t.Errorf("ParseMLSxLine(garbage) = %+v, want nil", entry)
+	}
+}
+
+func TestParserLocationAndClock(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*3600)
+	p := &Parser{
+		Location: tokyo,
+		Now:      func() time.Time { return time.Date(2024, 1, 2, 12, 0, 0, 0, tokyo) },
+	}
+
+	for _, lt := range []struct {
+		line  string
+		mtime time.Time
+	}{
+		{"-rw-r--r--   1 root     other     531 Dec 30 10:15 README", time.Date(2023, 12, 30, 10, 15, 0, 0, tokyo)},
+		{"-rw-r--r--   1 root     other     531 Jan  1 23:59 README", time.Date(2024, 1, 1, 23, 59, 0, 0, tokyo)},
+		{"dr-xr-xr-x   2 root     other     512 Apr  8  2003 etc", time.Date(2003, 4, 8, 0, 0, 0, 0, tokyo)},
+		{"04-27-00  09:09PM       <DIR>          licensed", time.Date(2000, 4, 27, 21, 9, 0, 0, tokyo)},
+	} {
+		entry := p.ParseLine(lt.line)
+		if entry == nil {
+			t.Errorf("Parser.ParseLine(%v) = nil", lt.line)
+		} else if !entry.Mtime.Equal(lt.mtime) {
+			t.Errorf("Parser.ParseLine(%v).mtime = %v, want %v", lt.line, entry.Mtime, lt.mtime)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package ftp
+
+import (
+	"io"
+	"io/fs"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Progress describes the state of a transfer made by Retr or Stor.
+type Progress struct {
+	Path    string
+	Bytes   int64         // bytes transferred so far
+	Total   int64         // size of the file, -1 if unknown
+	Elapsed time.Duration // time since the transfer started
+	Done    bool          // the transfer is over
+}
+
+// Rate returns the average throughput of the transfer, in bytes per second.
+func (p Progress) Rate() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Bytes) / p.Elapsed.Seconds()
+}
+
+// ProgressFunc is called as a transfer goes on, after each read of its
+// data, and a last time with Done set when it is over.
+type ProgressFunc func(p Progress)
+
+// SetProgress attaches fn to the transfers of Retr and Stor on this
+// connection, nil to detach it. For Retr the total size is known when the
+// server states it in its reply, for Stor when the reader has a Len or a
+// Stat method, as *bytes.Reader, *strings.Reader or *os.File.
+func (c *ServerConn) SetProgress(fn ProgressFunc) {
+	c.progress = fn
+}
+
+type progress struct {
+	fn    ProgressFunc
+	p     Progress
+	start time.Time
+}
+
+func newProgress(fn ProgressFunc, path string, total int64) *progress {
+	return &progress{fn: fn, p: Progress{Path: path, Total: total}, start: time.Now()}
+}
+
+func (p *progress) add(n int) {
+	if n <= 0 || p.p.Done {
+		return
+	}
+	p.p.Bytes += int64(n)
+	p.p.Elapsed = time.Since(p.start)
+	p.fn(p.p)
+}
+
+func (p *progress) finish() {
+	if p.p.Done {
+		return
+	}
+	p.p.Done = true
+	p.p.Elapsed = time.Since(p.start)
+	p.fn(p.p)
+}
+
+// progressReader reports the bytes read through it.
+type progressReader struct {
+	r io.Reader
+	p *progress
+}
+
+func (pr *progressReader) Read(buf []byte) (int, error) {
+	n, err := pr.r.Read(buf)
+	pr.p.add(n)
+	return n, err
+}
+
+// "150 Opening BINARY mode data connection for file.txt (1234 bytes)."
+var transferSizeRe = regexp.MustCompile(`\((\d+) bytes\)`)
+
+// transferSize returns the size stated in the preliminary reply of a
+// transfer, or -1.
+func transferSize(msg string) int64 {
+	m := transferSizeRe.FindStringSubmatch(msg)
+	if m == nil {
+		return -1
+	}
+	size, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// readerSize returns the number of bytes left in r, or -1 if unknown.
+func readerSize(r io.Reader) int64 {
+	switch r := r.(type) {
+	case interface{ Len() int }:
+		return int64(r.Len())
+	case interface{ Stat() (fs.FileInfo, error) }:
+		fi, err := r.Stat()
+		if err != nil || !fi.Mode().IsRegular() {
+			return -1
+		}
+		if s, ok := r.(io.Seeker); ok {
+			if off, err := s.Seek(0, io.SeekCurrent); err == nil {
+				return fi.Size() - off
+			}
+		}
+		return fi.Size()
+	}
+	return -1
+}
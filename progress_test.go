@@ -0,0 +1,51 @@
+package ftp
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	data := strings.Repeat("x", 100000)
+	s := newTestServer(t, map[string]string{"/file": data})
+	c := s.conn()
+
+	var reports []Progress
+	c.SetProgress(func(p Progress) { reports = append(reports, p) })
+	check := func(op string, total int64) {
+		if len(reports) < 2 {
+			t.Fatalf("%s: got %d reports", op, len(reports))
+		}
+		last := reports[len(reports)-1]
+		if !last.Done || last.Bytes != int64(len(data)) || last.Total != total || last.Path != "/file" {
+			t.Errorf("%s: last report = %+v", op, last)
+		}
+		for i, p := range reports[:len(reports)-1] {
+			if p.Done || (i > 0 && p.Bytes < reports[i-1].Bytes) {
+				t.Errorf("%s: report %d = %+v", op, i, p)
+			}
+		}
+		reports = nil
+	}
+
+	r, err := c.Retr("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.Copy(io.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	check("Retr", int64(len(data)))
+
+	if err = c.Stor("/file", strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	check("Stor", int64(len(data)))
+
+	if err = c.Stor("/file", io.MultiReader(strings.NewReader(data))); err != nil {
+		t.Fatal(err)
+	}
+	check("Stor", -1)
+}
@@ -0,0 +1,141 @@
+package ftp
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+/*
+Limiter caps a throughput with a token bucket: it lets bursts of up to
+burst bytes through, then throttles to rate bytes per second.
+
+A Limiter can be set on a ServerConn with SetLimiter, where it applies to
+the data connections of Retr, Stor and List but not to the control
+connection. The same Limiter can be set on several connections, such as
+those of a pool, to cap them together. It can also wrap the reader or the
+writer of a single transfer.
+*/
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a Limiter of rate bytes per second, with bursts of up
+// to burst bytes. If burst is 0, a tenth of a second of rate is used. Like
+// time.NewTicker, it panics if rate is not positive; to stop limiting,
+// remove the Limiter with SetLimiter instead.
+func NewLimiter(rate int64, burst int) *Limiter {
+	if rate <= 0 {
+		panic("ftp: non-positive rate for NewLimiter")
+	}
+	if burst <= 0 {
+		burst = int(rate / 10)
+		if burst < 1 {
+			burst = 1
+		}
+	}
+	return &Limiter{rate: float64(rate), burst: burst, tokens: float64(burst), last: time.Now()}
+}
+
+// wait blocks until n bytes can go through.
+func (l *Limiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
+
+// Reader returns a reader which reads from r at the rate of l.
+func (l *Limiter) Reader(r io.Reader) io.Reader {
+	return &limitedReader{r: r, limiters: []*Limiter{l}}
+}
+
+// Writer returns a writer which writes to w at the rate of l.
+func (l *Limiter) Writer(w io.Writer) io.Writer {
+	return &limitedWriter{w: w, limiters: []*Limiter{l}}
+}
+
+// SetLimiter sets the limiters applied to the data connections of this
+// connection, such as one for the connection and one shared by a pool.
+// Calling it without limiters removes them.
+func (c *ServerConn) SetLimiter(limiters ...*Limiter) {
+	c.limiters = limiters
+}
+
+// chunk returns the largest read or write which the limiters let through
+// at once.
+func chunk(limiters []*Limiter, n int) int {
+	for _, l := range limiters {
+		if n > l.burst {
+			n = l.burst
+		}
+	}
+	return n
+}
+
+type limitedReader struct {
+	r        io.Reader
+	limiters []*Limiter
+}
+
+func (lr *limitedReader) Read(buf []byte) (int, error) {
+	n, err := lr.r.Read(buf[:chunk(lr.limiters, len(buf))])
+	for _, l := range lr.limiters {
+		l.wait(n)
+	}
+	return n, err
+}
+
+type limitedWriter struct {
+	w        io.Writer
+	limiters []*Limiter
+}
+
+func (lw *limitedWriter) Write(buf []byte) (written int, err error) {
+	for len(buf) > 0 {
+		n := chunk(lw.limiters, len(buf))
+		for _, l := range lw.limiters {
+			l.wait(n)
+		}
+		n, err = lw.w.Write(buf[:n])
+		written += n
+		if err != nil {
+			return
+		}
+		buf = buf[n:]
+	}
+	return
+}
+
+// limitedConn is a data connection throttled by limiters.
+type limitedConn struct {
+	net.Conn
+	r limitedReader
+	w limitedWriter
+}
+
+func newLimitedConn(conn net.Conn, limiters []*Limiter) *limitedConn {
+	return &limitedConn{
+		Conn: conn,
+		r:    limitedReader{r: conn, limiters: limiters},
+		w:    limitedWriter{w: conn, limiters: limiters},
+	}
+}
+
+func (lc *limitedConn) Read(buf []byte) (int, error)  { return lc.r.Read(buf) }
+func (lc *limitedConn) Write(buf []byte) (int, error) { return lc.w.Write(buf) }
@@ -0,0 +1,73 @@
+package ftp
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	data := strings.Repeat("x", 50000)
+	s := newTestServer(t, map[string]string{"/file": data})
+	c := s.conn()
+
+	// 50 kB at 100 kB/s with a burst of 10 kB take about 0.4 s
+	c.SetLimiter(NewLimiter(100000, 10000))
+	start := time.Now()
+	r, err := c.Retr("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.Copy(io.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Errorf("Retr took %v with a limiter", d)
+	}
+
+	start = time.Now()
+	if err = c.Stor("/file", strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Errorf("Stor took %v with a limiter", d)
+	}
+
+	// the control connection is not throttled
+	start = time.Now()
+	for i := 0; i < 10; i++ {
+		if err = c.NoOp(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("NoOp took %v with a limiter", d)
+	}
+
+	c.SetLimiter()
+	start = time.Now()
+	if err = c.Stor("/file", strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 200*time.Millisecond {
+		t.Errorf("Stor took %v without a limiter", d)
+	}
+}
+
+func TestNewLimiterRate(t *testing.T) {
+	for _, rate := range []int64{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewLimiter(%d) did not panic", rate)
+				}
+			}()
+			NewLimiter(rate, 0)
+		}()
+	}
+	if l := NewLimiter(5, 0); l.burst != 1 {
+		t.Errorf("burst of a slow Limiter = %d, want 1", l.burst)
+	}
+}
@@ -0,0 +1,168 @@
+package ftp
+
+import (
+	"errors"
+	"io"
+)
+
+// Reads smaller than remoteFileBlockSize are served from a cached block of
+// that size, so that scattered small reads do not each cost a transfer.
+const remoteFileBlockSize = 64 << 10
+
+/*
+RemoteFile gives random access to a file of the remote server. It
+implements io.ReaderAt and io.ReadSeeker by issuing REST+RETR at the
+requested offset, so that parts of large files can be read without
+downloading them.
+
+A transfer in flight is reused as long as the reads are sequential. While
+it is open, the ServerConn must not be used for anything else; Close ends
+it. A RemoteFile must not be used concurrently.
+*/
+type RemoteFile struct {
+	c    *ServerConn
+	path string
+	size int64
+
+	offset int64 // offset of Read and Seek
+
+	r   io.ReadCloser // transfer in flight
+	pos int64         // offset of r
+
+	cache    []byte
+	cacheOff int64
+}
+
+// OpenFile opens the remote file at path for random access. The connection
+// is switched to binary mode with TYPE I, and the size of the file is asked
+// to the server with SIZE.
+func (c *ServerConn) OpenFile(path string) (*RemoteFile, error) {
+	if err := c.binary(); err != nil {
+		return nil, err
+	}
+	size, err := c.FileSize(path)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteFile{c: c, path: path, size: size}, nil
+}
+
+// Size returns the size of the file, in bytes.
+func (f *RemoteFile) Size() int64 {
+	return f.size
+}
+
+// ReadAt reads len(buf) bytes of the file from offset off.
+func (f *RemoteFile) ReadAt(buf []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("ftp: negative offset")
+	}
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	p := buf
+	if remain := f.size - off; int64(len(p)) > remain {
+		p = p[:remain]
+	}
+
+	for n < len(p) && err == nil {
+		at := off + int64(n)
+		if at >= f.cacheOff && at < f.cacheOff+int64(len(f.cache)) {
+			n += copy(p[n:], f.cache[at-f.cacheOff:])
+			continue
+		}
+		if len(p)-n >= remoteFileBlockSize {
+			var m int
+			m, err = f.readStream(p[n:], at)
+			n += m
+			continue
+		}
+
+		block := int64(remoteFileBlockSize)
+		if remain := f.size - at; block > remain {
+			block = remain
+		}
+		if f.cache == nil {
+			f.cache = make([]byte, 0, remoteFileBlockSize)
+		}
+		var m int
+		m, err = f.readStream(f.cache[:block], at)
+		f.cache, f.cacheOff = f.cache[:m], at
+		if m == 0 {
+			break
+		}
+	}
+
+	if err == nil && n < len(buf) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// readStream fills p from offset off, reusing the transfer in flight if it
+// stands at off.
+func (f *RemoteFile) readStream(p []byte, off int64) (int, error) {
+	if f.r == nil || f.pos != off {
+		if err := f.closeStream(); err != nil {
+			return 0, err
+		}
+		r, err := f.c.RetrFrom(f.path, off)
+		if err != nil {
+			return 0, err
+		}
+		f.r, f.pos = r, off
+	}
+
+	n, err := io.ReadFull(f.r, p)
+	f.pos += int64(n)
+	if err != nil {
+		f.closeStream()
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+	}
+	return n, err
+}
+
+func (f *RemoteFile) closeStream() error {
+	if f.r == nil {
+		return nil
+	}
+	err := f.r.Close()
+	f.r = nil
+	return err
+}
+
+// Read reads up to len(buf) bytes from the current offset.
+func (f *RemoteFile) Read(buf []byte) (int, error) {
+	n, err := f.ReadAt(buf, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the offset of the next Read, as io.Seeker.
+func (f *RemoteFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, errors.New("ftp: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("ftp: negative offset")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Close ends the transfer in flight, if any.
+func (f *RemoteFile) Close() error {
+	f.cache = nil
+	return f.closeStream()
+}
@@ -0,0 +1,86 @@
+package ftp
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestRemoteFile(t *testing.T) {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(bytes.Repeat([]byte(name), 100000))
+	}
+	zw.Close()
+
+	s := newTestServer(t, map[string]string{"/archive.zip": archive.String()})
+	c := s.conn()
+	f, err := c.OpenFile("/archive.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zr, err := zip.NewReader(f, f.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 3 || zr.File[1].Name != "b.txt" {
+		t.Fatalf("read the wrong central directory: %v", zr.File)
+	}
+	r, err := zr.File[1].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, bytes.Repeat([]byte("b.txt"), 100000)) {
+		t.Error("read wrong data for b.txt")
+	}
+
+	// small reads are cached
+	buf := make([]byte, 10)
+	retrs := s.count("RETR")
+	for off := int64(1000); off < 2000; off += 10 {
+		if _, err = f.ReadAt(buf, off); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, archive.Bytes()[off:off+10]) {
+			t.Errorf("ReadAt(%d) = %q", off, buf)
+		}
+	}
+	if n := s.count("RETR") - retrs; n != 1 {
+		t.Errorf("small reads issued %d RETR, want 1", n)
+	}
+
+	// sequential reads share one transfer
+	retrs = s.count("RETR")
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	data, err = io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, archive.Bytes()) {
+		t.Error("read wrong data for the whole file")
+	}
+	if n := s.count("RETR") - retrs; n != 1 {
+		t.Errorf("sequential reads issued %d RETR, want 1", n)
+	}
+
+	if err = f.Close(); err != nil {
+		t.Error(err)
+	}
+	if err = c.NoOp(); err != nil {
+		t.Error(err)
+	}
+}
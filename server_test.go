@@ -0,0 +1,553 @@
+package ftp
+
+import (
+	"bufio"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testServer is a minimal in-memory FTP server, just good enough to
+// exercise the client against.
+type testServer struct {
+	t      *testing.T
+	ln     net.Listener
+	noRest bool              // reject REST and do not advertise it
+	mlsd   bool              // support and advertise MLST and MLSD
+	syst   string            // reply to SYST, "UNIX Type: L8" if empty
+	utf8   bool              // advertise UTF8 and accept OPTS UTF8 ON
+	keep   bool              // refuse RNTO over an existing file, with 550
+	rnto   int               // reply code of every RNTO, instead of renaming
+	noFeat bool              // reject FEAT
+	mlst   int               // reply code of every MLST, instead of the facts
+	aborts map[string]int    // final reply code of LIST and MLSD by directory, instead of 226
+	ascii  bool              // refuse SIZE and REST in ASCII mode, the default
+	lists  map[string]string // raw LIST output by directory, instead of the files
+
+	mu       sync.Mutex
+	files    map[string]*testFile
+	commands map[string]int // number of commands received, by verb
+}
+
+type testFile struct {
+	dir   bool
+	data  []byte
+	mtime time.Time
+	link  string // target of a symbolic link
+}
+
+var testMtime = time.Now().UTC().Add(-time.Hour).Truncate(time.Minute)
+
+// newTestServer starts a server holding the given files, keyed by their
+// absolute paths. Parent directories are created as needed.
+func newTestServer(t *testing.T, files map[string]string) *testServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{
+		t:        t,
+		ln:       ln,
+		files:    map[string]*testFile{"/": {dir: true, mtime: testMtime}},
+		commands: make(map[string]int),
+	}
+	for name, data := range files {
+		s.mkdirAll(path.Dir(name))
+		s.files[name] = &testFile{data: []byte(data), mtime: testMtime}
+	}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *testServer) mkdirAll(dir string) {
+	for ; dir != "/"; dir = path.Dir(dir) {
+		if _, ok := s.files[dir]; !ok {
+			s.files[dir] = &testFile{dir: true, mtime: testMtime}
+		}
+	}
+}
+
+// symlink adds a symbolic link at name pointing to target.
+func (s *testServer) symlink(name, target string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[name] = &testFile{link: target, mtime: testMtime}
+}
+
+func (s *testServer) addr() string {
+	return s.ln.Addr().String()
+}
+
+// dial returns a logged-in connection to the server.
+func (s *testServer) dial() (*ServerConn, error) {
+	c, err := Connect(s.addr())
+	if err != nil {
+		return nil, err
+	}
+	if err = c.Login("anonymous", "anonymous"); err != nil {
+		c.Quit()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *testServer) conn() *ServerConn {
+	c, err := s.dial()
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.t.Cleanup(func() { c.Quit() })
+	return c
+}
+
+// count returns the number of commands verb received so far.
+func (s *testServer) count(verb string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.commands[verb]
+}
+
+func (s *testServer) file(name string) *testFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.files[name]
+}
+
+// resolve follows the symbolic links in the components of name.
+func (s *testServer) resolve(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resolved := "/"
+	for _, elem := range strings.Split(name, "/") {
+		if elem == "" {
+			continue
+		}
+		resolved = path.Join(resolved, elem)
+		for i := 0; i < 10; i++ {
+			f := s.files[resolved]
+			if f == nil || f.link == "" {
+				break
+			}
+			if path.IsAbs(f.link) {
+				resolved = f.link
+			} else {
+				resolved = path.Join(path.Dir(resolved), f.link)
+			}
+		}
+	}
+	return resolved
+}
+
+func (s *testServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// session holds the state of one control connection.
+type session struct {
+	s    *testServer
+	w    *bufio.Writer
+	cwd  string
+	rest int64
+	pasv net.Listener
+	from string
+
+	transferMsg string // message of the next preliminary reply
+	transferEnd int    // code of the next final reply, if not 226
+	binary      bool   // TYPE I was received
+}
+
+func (ss *session) reply(code int, format string, args ...interface{}) {
+	fmt.Fprintf(ss.w, "%d %s\r\n", code, fmt.Sprintf(format, args...))
+	ss.w.Flush()
+}
+
+func (ss *session) abs(name string) string {
+	if !strings.HasPrefix(name, "/") {
+		name = path.Join(ss.cwd, name)
+	}
+	return path.Clean(name)
+}
+
+// data accepts the data connection opened by the client after PASV.
+func (ss *session) data() net.Conn {
+	if ss.pasv == nil {
+		return nil
+	}
+	defer func() { ss.pasv = nil }()
+	defer ss.pasv.Close()
+	conn, err := ss.pasv.Accept()
+	if err != nil {
+		return nil
+	}
+	return conn
+}
+
+func (s *testServer) handle(conn net.Conn) {
+	defer conn.Close()
+	ss := &session{s: s, w: bufio.NewWriter(conn), cwd: "/"}
+	ss.reply(StatusReady, "test server ready")
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg := line, ""
+		if i := strings.Index(line, " "); i >= 0 {
+			verb, arg = line[:i], line[i+1:]
+		}
+		verb = strings.ToUpper(verb)
+		s.mu.Lock()
+		s.commands[verb]++
+		s.mu.Unlock()
+		if !ss.command(verb, arg) {
+			return
+		}
+	}
+}
+
+func (ss *session) command(verb, arg string) bool {
+	s := ss.s
+	switch verb {
+	case "USER":
+		ss.reply(StatusUserOK, "password please")
+	case "PASS":
+		ss.reply(StatusLoggedIn, "logged in")
+	case "NOOP":
+		ss.reply(StatusCommandOK, "ok")
+	case "QUIT":
+		ss.reply(StatusClosing, "bye")
+		return false
+	case "FEAT":
+		if s.noFeat {
+			ss.reply(StatusBadCommand, "unknown command")
+			break
+		}
+		fmt.Fprintf(ss.w, "211-Features:\r\n SIZE\r\n")
+		if s.mlsd {
+			fmt.Fprintf(ss.w, " MLST type*;size*;modify*;\r\n")
+		}
+		if !s.noRest {
+			fmt.Fprintf(ss.w, " REST STREAM\r\n")
+		}
+		if s.utf8 {
+			fmt.Fprintf(ss.w, " UTF8\r\n")
+		}
+		ss.reply(StatusSystem, "End")
+	case "OPTS":
+		if s.utf8 && strings.EqualFold(arg, "UTF8 ON") {
+			ss.reply(StatusCommandOK, "UTF8 mode enabled")
+		} else {
+			ss.reply(StatusNotImplementedParameter, "option not supported")
+		}
+	case "PASV":
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			ss.reply(StatusCanNotOpenDataConnection, "%v", err)
+			break
+		}
+		ss.pasv = ln
+		port := ln.Addr().(*net.TCPAddr).Port
+		ss.reply(StatusPassiveMode, "Entering Passive Mode (127,0,0,1,%d,%d)", port/256, port%256)
+	case "PWD":
+		ss.reply(StatusPathCreated, "\"%s\" is the current directory", ss.cwd)
+	case "CWD":
+		if f := s.file(s.resolve(ss.abs(arg))); f != nil && f.dir {
+			ss.cwd = ss.abs(arg)
+			ss.reply(StatusRequestedFileActionOK, "ok")
+		} else {
+			ss.reply(StatusFileUnavailable, "no such directory")
+		}
+	case "CDUP":
+		ss.cwd = path.Dir(ss.cwd)
+		ss.reply(StatusRequestedFileActionOK, "ok")
+	case "TYPE":
+		ss.binary = strings.EqualFold(arg, "I")
+		ss.reply(StatusCommandOK, "type set to %s", arg)
+	case "SIZE":
+		if s.ascii && !ss.binary {
+			ss.reply(StatusFileUnavailable, "SIZE not allowed in ASCII mode")
+			break
+		}
+		if f := s.file(s.resolve(ss.abs(arg))); f != nil && !f.dir {
+			ss.reply(StatusFile, "%d", len(f.data))
+		} else {
+			ss.reply(StatusFileUnavailable, "no such file")
+		}
+	case "MDTM":
+		if f := s.file(s.resolve(ss.abs(arg))); f != nil && !f.dir {
+			ss.reply(StatusFile, "%s", f.mtime.Format("20060102150405"))
+		} else {
+			ss.reply(StatusFileUnavailable, "no such file")
+		}
+	case "MLST":
+		if s.mlst != 0 {
+			ss.reply(s.mlst, "cannot list")
+			break
+		}
+		name := s.resolve(ss.abs(arg))
+		f := s.file(name)
+		if !s.mlsd || f == nil {
+			ss.reply(StatusFileUnavailable, "no such file")
+			break
+		}
+		fmt.Fprintf(ss.w, "250-Listing %s\r\n %s", name, mlsxLine(name, f))
+		ss.reply(StatusRequestedFileActionOK, "End")
+	case "XMD5":
+		if f := s.file(s.resolve(ss.abs(arg))); f != nil && !f.dir {
+			ss.reply(StatusRequestedFileActionOK, "%x", md5.Sum(f.data))
+		} else {
+			ss.reply(StatusFileUnavailable, "no such file")
+		}
+	case "REST":
+		if s.noRest {
+			ss.reply(StatusBadCommand, "unknown command")
+			break
+		}
+		if s.ascii && !ss.binary {
+			ss.reply(StatusFileUnavailable, "REST not allowed in ASCII mode")
+			break
+		}
+		ss.rest, _ = strconv.ParseInt(arg, 10, 64)
+		ss.reply(StatusRequestFilePending, "restarting at %d", ss.rest)
+	case "RETR":
+		f := s.file(s.resolve(ss.abs(arg)))
+		if f == nil || f.dir {
+			ss.reply(StatusFileUnavailable, "no such file")
+			break
+		}
+		offset := ss.rest
+		ss.rest = 0
+		if offset > int64(len(f.data)) {
+			offset = int64(len(f.data))
+		}
+		ss.transferMsg = fmt.Sprintf("opening data connection for %s (%d bytes)", arg, len(f.data))
+		ss.transfer(func(conn net.Conn) error {
+			_, err := conn.Write(f.data[offset:])
+			return err
+		})
+	case "STOR":
+		name := ss.abs(arg)
+		ss.transfer(func(conn net.Conn) error {
+			data, err := io.ReadAll(conn)
+			if err != nil {
+				return err
+			}
+			s.mu.Lock()
+			s.files[name] = &testFile{data: data, mtime: testMtime}
+			s.mu.Unlock()
+			return nil
+		})
+	case "SYST":
+		syst := s.syst
+		if syst == "" {
+			syst = "UNIX Type: L8"
+		}
+		ss.reply(StatusName, syst)
+	case "LIST":
+		name := s.resolve(ss.abs(strings.TrimSpace(strings.TrimPrefix(arg, "-a"))))
+		if list, ok := s.lists[name]; ok {
+			ss.transferEnd = s.aborts[name]
+			ss.transfer(func(conn net.Conn) error {
+				_, err := io.WriteString(conn, list)
+				return err
+			})
+			break
+		}
+		lines, ok := s.list(name, false)
+		if !ok {
+			ss.reply(StatusFileUnavailable, "no such file or directory")
+			break
+		}
+		ss.transferEnd = s.aborts[name]
+		ss.transfer(func(conn net.Conn) error {
+			_, err := io.WriteString(conn, strings.Join(lines, ""))
+			return err
+		})
+	case "MLSD":
+		if !s.mlsd {
+			ss.reply(StatusBadCommand, "unknown command")
+			break
+		}
+		name := s.resolve(ss.abs(arg))
+		lines, ok := s.list(name, true)
+		if !ok {
+			ss.reply(StatusFileUnavailable, "no such directory")
+			break
+		}
+		ss.transferEnd = s.aborts[name]
+		ss.transfer(func(conn net.Conn) error {
+			_, err := io.WriteString(conn, strings.Join(lines, ""))
+			return err
+		})
+	case "MKD":
+		name := ss.abs(arg)
+		s.mu.Lock()
+		_, exists := s.files[name]
+		parent := s.files[path.Dir(name)]
+		if !exists && parent != nil && parent.dir {
+			s.files[name] = &testFile{dir: true, mtime: testMtime}
+		}
+		s.mu.Unlock()
+		if exists || parent == nil || !parent.dir {
+			ss.reply(StatusFileUnavailable, "cannot create directory")
+		} else {
+			ss.reply(StatusPathCreated, "\"%s\" created", name)
+		}
+	case "RMD", "DELE":
+		// like a real server, follow the links of the parents but not of
+		// the name itself
+		name := ss.abs(arg)
+		name = path.Join(s.resolve(path.Dir(name)), path.Base(name))
+		s.mu.Lock()
+		f := s.files[name]
+		ok := f != nil && f.dir == (verb == "RMD")
+		for other := range s.files {
+			if ok && strings.HasPrefix(other, name+"/") {
+				ok = false
+			}
+		}
+		if ok {
+			delete(s.files, name)
+		}
+		s.mu.Unlock()
+		if ok {
+			ss.reply(StatusRequestedFileActionOK, "removed")
+		} else {
+			ss.reply(StatusFileUnavailable, "cannot remove")
+		}
+	case "RNFR":
+		ss.from = ss.abs(arg)
+		ss.reply(StatusRequestFilePending, "ready for RNTO")
+	case "RNTO":
+		if s.rnto != 0 {
+			ss.reply(s.rnto, "cannot rename")
+			break
+		}
+		name := ss.abs(arg)
+		s.mu.Lock()
+		f := s.files[ss.from]
+		if f != nil && s.keep && s.files[name] != nil {
+			s.mu.Unlock()
+			ss.reply(StatusFileUnavailable, "file exists")
+			break
+		}
+		if f != nil {
+			delete(s.files, ss.from)
+			s.files[name] = f
+		}
+		s.mu.Unlock()
+		if f != nil {
+			ss.reply(StatusRequestedFileActionOK, "renamed")
+		} else {
+			ss.reply(StatusFileUnavailable, "no such file")
+		}
+	default:
+		ss.reply(StatusBadCommand, "unknown command")
+	}
+	return true
+}
+
+// transfer runs fn over the data connection, wrapped in the usual
+// preliminary and completion replies.
+func (ss *session) transfer(fn func(conn net.Conn) error) {
+	conn := ss.data()
+	if conn == nil {
+		ss.reply(StatusCanNotOpenDataConnection, "no data connection")
+		return
+	}
+	msg := "opening data connection"
+	if ss.transferMsg != "" {
+		msg, ss.transferMsg = ss.transferMsg, ""
+	}
+	ss.reply(StatusAboutToSend, "%s", msg)
+	err := fn(conn)
+	conn.Close()
+	if err != nil {
+		ss.reply(StatusTransfertAborted, "transfer aborted")
+		return
+	}
+	if ss.transferEnd != 0 {
+		code := ss.transferEnd
+		ss.transferEnd = 0
+		ss.reply(code, "transfer aborted")
+		return
+	}
+	ss.reply(StatusClosingDataConnection, "transfer complete")
+}
+
+// list returns the LIST lines for a directory, or for a single file, or the
+// MLSD lines if mlsx is set.
+func (s *testServer) list(name string, mlsx bool) ([]string, bool) {
+	format := unixLine
+	if mlsx {
+		format = mlsxLine
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.files[name]
+	if f == nil {
+		return nil, false
+	}
+	if !f.dir {
+		return []string{format(path.Base(name), f)}, true
+	}
+	var names []string
+	for other := range s.files {
+		if other != name && path.Dir(other) == name {
+			names = append(names, other)
+		}
+	}
+	sort.Strings(names)
+	var lines []string
+	if mlsx {
+		lines = append(lines, format(".", &testFile{dir: true, mtime: f.mtime}))
+	} else {
+		lines = append(lines, "total 42\r\n")
+	}
+	for _, other := range names {
+		lines = append(lines, format(path.Base(other), s.files[other]))
+	}
+	return lines, true
+}
+
+func unixLine(name string, f *testFile) string {
+	perm := "-rw-r--r--"
+	if f.dir {
+		perm = "drwxr-xr-x"
+	} else if f.link != "" {
+		perm = "lrwxrwxrwx"
+		name += " -> " + f.link
+	}
+	return fmt.Sprintf("%s   1 owner    group %10d %s %s\r\n",
+		perm, len(f.data), f.mtime.Format("Jan _2 15:04"), name)
+}
+
+func mlsxLine(name string, f *testFile) string {
+	facts := fmt.Sprintf("type=file;size=%d;", len(f.data))
+	if name == "." {
+		facts = "type=cdir;"
+	} else if f.dir {
+		facts = "type=dir;"
+	} else if f.link != "" {
+		facts = "type=OS.unix=slink:" + f.link + ";"
+	}
+	return fmt.Sprintf("%smodify=%s; %s\r\n", facts, f.mtime.Format("20060102150405"), name)
+}
@@ -0,0 +1,92 @@
+package ftp
+
+import (
+	"io/fs"
+	"net/textproto"
+	"path"
+	"strings"
+)
+
+/*
+Stat returns a FileInfo describing the file or directory at name on the
+remote server. Its Sys method returns the *FTPListData of the file.
+
+The server is asked with MLST when it supports it. Otherwise, or if MLST
+is refused with another reply than 550, a file is recognized by SIZE, with
+its time given by MDTM, and anything else is looked up in the listing of
+its parent directory. If there is no such file the error is an
+*fs.PathError wrapping fs.ErrNotExist.
+*/
+func (c *ServerConn) Stat(name string) (fs.FileInfo, error) {
+	clean := path.Clean(name)
+	if clean == "/" || clean == "." {
+		entry := newFTPListData("")
+		entry.Name = clean
+		entry.TryCwd = true
+		return &fileInfo{entry}, nil
+	}
+
+	if c.hasFeature("MLST") {
+		entry, err := c.mlst(name)
+		if err == nil {
+			entry.Name = path.Base(clean)
+			return &fileInfo{entry}, nil
+		}
+		// some servers advertise MLST but reject it for some paths, so
+		// only a 550 is taken as the answer
+		if e, ok := err.(*textproto.Error); !ok || e.Code == StatusFileUnavailable {
+			return nil, pathError("stat", name, err)
+		}
+	}
+
+	if size, err := c.FileSize(name); err == nil {
+		entry := newFTPListData("")
+		entry.Name = path.Base(clean)
+		entry.TryRetr = true
+		entry.Size = uint64(size)
+		if mtime, err := c.ModTime(name); err == nil {
+			entry.MtimeType = LOCAL_MTIME_TYPE
+			entry.Mtime = mtime
+		}
+		return &fileInfo{entry}, nil
+	} else if _, ok := err.(*textproto.Error); !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	entry, err := c.lookup(clean)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return &fileInfo{entry}, nil
+}
+
+// lookup finds the entry of name in the listing of its parent directory.
+// It returns fs.ErrNotExist if there is none.
+func (c *ServerConn) lookup(name string) (*FTPListData, error) {
+	entries, err := c.readDir(path.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+	base := path.Base(name)
+	for _, entry := range entries {
+		if entry.Name == base {
+			return entry, nil
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+// mlst asks the server for the facts of a single file with MLST.
+func (c *ServerConn) mlst(name string) (*FTPListData, error) {
+	_, msg, err := c.cmdLines(StatusRequestedFileActionOK, "MLST %s", name)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(msg, "\n")
+	for _, line := range lines[1:] {
+		if entry := ParseMLSxLine(c.decode(line)); entry != nil {
+			return entry, nil
+		}
+	}
+	return nil, textproto.ProtocolError("invalid MLST response: " + msg)
+}
@@ -0,0 +1,69 @@
+package ftp
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func TestStat(t *testing.T) {
+	for _, mlsd := range []bool{false, true} {
+		s := newTestServer(t, map[string]string{"/pub/file.txt": "Just some text"})
+		s.mlsd = mlsd
+		c := s.conn()
+
+		fi, err := c.Stat("/pub/file.txt")
+		if err != nil {
+			t.Fatalf("mlsd=%v: %v", mlsd, err)
+		}
+		if fi.Name() != "file.txt" || fi.IsDir() || fi.Size() != 14 || !fi.Mode().IsRegular() {
+			t.Errorf("mlsd=%v: Stat(file) = %v %v %v %v", mlsd, fi.Name(), fi.IsDir(), fi.Size(), fi.Mode())
+		}
+		if !fi.ModTime().Equal(testMtime) {
+			t.Errorf("mlsd=%v: Stat(file).ModTime = %v, want %v", mlsd, fi.ModTime(), testMtime)
+		}
+		if _, ok := fi.Sys().(*FTPListData); !ok {
+			t.Errorf("mlsd=%v: Stat(file).Sys = %T", mlsd, fi.Sys())
+		}
+
+		fi, err = c.Stat("/pub")
+		if err != nil {
+			t.Fatalf("mlsd=%v: %v", mlsd, err)
+		}
+		if fi.Name() != "pub" || !fi.IsDir() {
+			t.Errorf("mlsd=%v: Stat(dir) = %v %v", mlsd, fi.Name(), fi.IsDir())
+		}
+
+		_, err = c.Stat("/pub/missing")
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("mlsd=%v: Stat(missing) = %v, want fs.ErrNotExist", mlsd, err)
+		}
+	}
+}
+
+func TestStatMLSTRefused(t *testing.T) {
+	s := newTestServer(t, map[string]string{"/pub/file.txt": "Just some text"})
+	s.mlsd = true
+	s.mlst = StatusBadArguments
+	c := s.conn()
+
+	fi, err := c.Stat("/pub/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Name() != "file.txt" || fi.IsDir() || fi.Size() != 14 {
+		t.Errorf("Stat(file) = %v %v %v", fi.Name(), fi.IsDir(), fi.Size())
+	}
+	if fi, err = c.Stat("/pub"); err != nil || !fi.IsDir() {
+		t.Errorf("Stat(dir) = %v, %v", fi, err)
+	}
+	if n := s.count("SIZE"); n != 2 {
+		t.Errorf("SIZE sent %d times, want 2", n)
+	}
+
+	// a 550 is the answer
+	s.mlst = StatusFileUnavailable
+	if _, err = c.Stat("/pub/file.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat after a 550 = %v, want fs.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,635 @@
+package ftp
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CompareMode selects how a Syncer decides that a file has changed.
+// The modes can be combined.
+type CompareMode int
+
+const (
+	CompareSize     CompareMode = 1 << iota // the sizes differ
+	CompareMtime                            // the source is newer
+	CompareChecksum                         // the checksums differ
+)
+
+// SyncOp is the kind of a SyncAction.
+type SyncOp int
+
+const (
+	SyncMkdir    SyncOp = iota // create a directory on the destination side
+	SyncDownload               // copy a remote file to local disk
+	SyncUpload                 // copy a local file to the server
+	SyncDelete                 // delete a file or directory on the destination side
+)
+
+var syncOpText = map[SyncOp]string{
+	SyncMkdir:    "mkdir",
+	SyncDownload: "download",
+	SyncUpload:   "upload",
+	SyncDelete:   "delete",
+}
+
+func (op SyncOp) String() string {
+	return syncOpText[op]
+}
+
+// SyncAction is a step taken, or planned in dry-run mode, by a Syncer.
+type SyncAction struct {
+	Op   SyncOp
+	Path string // slash-separated path, relative to the synced roots
+	Size int64
+}
+
+func (a SyncAction) String() string {
+	return fmt.Sprintf("%s %s", a.Op, a.Path)
+}
+
+/*
+Syncer mirrors a remote directory tree to local disk, or a local tree to
+the server. Remote files are listed with Walk, compared with the local
+ones, and only the changed ones are transferred with Retr or Stor.
+
+Include and Exclude hold glob patterns, in the syntax of path.Match, which
+are matched against both the relative path and the base name of each file.
+When Include is not empty only the matching files are synced; the files
+matching Exclude are never synced, and the directories matching it are not
+entered. Excluded local files are never deleted.
+
+Symbolic links are not followed: a remote link is neither downloaded nor
+deleted, and neither is the local file or directory of the same name.
+Only the regular local files are uploaded.
+*/
+type Syncer struct {
+	// Conn is used to list the remote tree, and for the transfers when
+	// Concurrency is 1.
+	Conn *ServerConn
+
+	// Dial opens the extra connections used when Concurrency is above 1.
+	Dial DialFunc
+
+	// Compare selects how changed files are detected. CompareSize and
+	// CompareMtime are used when it is 0.
+	Compare CompareMode
+
+	// Delete removes the files and directories of the destination side
+	// which are not on the source side.
+	Delete bool
+
+	Include []string
+	Exclude []string
+
+	// DryRun only plans the actions, without taking them.
+	DryRun bool
+
+	// TempName, if set, makes the uploads atomic: the files are stored
+	// under a temporary name and renamed into place, see StorAtomic.
+	TempName TempNameFunc
+
+	// Concurrency is the number of transfers run at once, 1 when it is 0.
+	Concurrency int
+}
+
+// Download mirrors the remote directory to the local directory, and
+// returns the actions taken, or planned in dry-run mode.
+func (s *Syncer) Download(remote, local string) ([]SyncAction, error) {
+	actions, infos, err := s.planDownload(remote, local)
+	if err != nil || s.DryRun {
+		return actions, err
+	}
+
+	var transfers []SyncAction
+	for _, a := range actions {
+		switch a.Op {
+		case SyncMkdir:
+			err = os.MkdirAll(filepath.Join(local, filepath.FromSlash(a.Path)), 0755)
+		case SyncDelete:
+			err = os.RemoveAll(filepath.Join(local, filepath.FromSlash(a.Path)))
+		case SyncDownload:
+			transfers = append(transfers, a)
+		}
+		if err != nil {
+			return actions, err
+		}
+	}
+
+	err = s.run(transfers, func(c *ServerConn, a SyncAction) error {
+		return download(c, path.Join(remote, a.Path), filepath.Join(local, filepath.FromSlash(a.Path)), infos[a.Path])
+	})
+	return actions, err
+}
+
+// planDownload compares the trees and returns the actions to take, and the
+// details of the remote files to download.
+func (s *Syncer) planDownload(remote, local string) ([]SyncAction, map[string]fs.FileInfo, error) {
+	var actions []SyncAction
+	remoteFiles := make(map[string]fs.FileInfo)
+	remoteDirs := make(map[string]bool)
+	remoteLinks := make(map[string]bool)
+
+	err := s.Conn.Walk(remote, func(name string, entry *FTPListData, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(name, remote), "/")
+		if rel == "" {
+			return nil
+		}
+		if entry.isLink() {
+			// a link may lead to a directory, which RETR would refuse
+			remoteLinks[rel] = true
+			return nil
+		}
+		if entry.isDir() {
+			if s.excluded(rel) {
+				return fs.SkipDir
+			}
+			remoteDirs[rel] = true
+			if fi, err := os.Stat(filepath.Join(local, filepath.FromSlash(rel))); err != nil || !fi.IsDir() {
+				actions = append(actions, SyncAction{Op: SyncMkdir, Path: rel})
+			}
+			return nil
+		}
+		if !entry.TryRetr || !s.selected(rel) {
+			return nil
+		}
+
+		info := &fileInfo{entry}
+		remoteFiles[rel] = info
+		localName := filepath.Join(local, filepath.FromSlash(rel))
+		fi, err := os.Stat(localName)
+		if os.IsNotExist(err) {
+			fi = nil
+		} else if err != nil {
+			return err
+		}
+		changed, err := s.changed(info, fi, func(algo string) ([]byte, error) {
+			f, err := os.Open(localName)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			return checksum(algo, f)
+		}, name)
+		if err != nil {
+			return err
+		}
+		if changed {
+			actions = append(actions, SyncAction{Op: SyncDownload, Path: rel, Size: info.Size()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if s.Delete {
+		root := filepath.Clean(local)
+		err = filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if name == root {
+				return nil
+			}
+			rel, err := filepath.Rel(root, name)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if remoteLinks[rel] {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				if s.excluded(rel) {
+					return fs.SkipDir
+				}
+				if !remoteDirs[rel] {
+					actions = append(actions, SyncAction{Op: SyncDelete, Path: rel})
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if _, ok := remoteFiles[rel]; !ok && s.selected(rel) {
+				actions = append(actions, SyncAction{Op: SyncDelete, Path: rel})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return actions, remoteFiles, nil
+}
+
+// changed reports whether the destination file dst, nil if it does not
+// exist, differs from the source file src. For the checksums, the remote
+// file is named by remote and localSum computes the sum of the local file.
+func (s *Syncer) changed(src, dst fs.FileInfo, localSum func(algo string) ([]byte, error), remote string) (bool, error) {
+	if dst == nil || dst.IsDir() {
+		return true, nil
+	}
+
+	mode := s.Compare
+	if mode == 0 {
+		mode = CompareSize | CompareMtime
+	}
+	if mode&CompareSize != 0 && src.Size() != dst.Size() {
+		return true, nil
+	}
+	if mode&CompareMtime != 0 && !src.ModTime().IsZero() && !dst.ModTime().IsZero() {
+		// compare at the precision of the listings
+		precision := mtimePrecision(src)
+		if p := mtimePrecision(dst); p > precision {
+			precision = p
+		}
+		if src.ModTime().Truncate(precision).After(dst.ModTime().Truncate(precision)) {
+			return true, nil
+		}
+	}
+	if mode&CompareChecksum != 0 {
+		algo, sum, err := s.Conn.Checksum(remote)
+		if err != nil {
+			return false, err
+		}
+		sum2, err := localSum(algo)
+		if err != nil {
+			return false, err
+		}
+		return !bytes.Equal(sum, sum2), nil
+	}
+	return false, nil
+}
+
+// mtimePrecision returns the precision of the modification time of a file.
+func mtimePrecision(fi fs.FileInfo) time.Duration {
+	if entry, ok := fi.Sys().(*FTPListData); ok {
+		switch entry.MtimeType {
+		case REMOTE_MINUTE_MTIME_TYPE:
+			return time.Minute
+		case REMOTE_DAY_MTIME_TYPE:
+			return 24 * time.Hour
+		}
+	}
+	return time.Second
+}
+
+// selected reports whether the file at the relative path rel is synced.
+func (s *Syncer) selected(rel string) bool {
+	if s.excluded(rel) {
+		return false
+	}
+	return len(s.Include) == 0 || matchAny(s.Include, rel)
+}
+
+func (s *Syncer) excluded(rel string) bool {
+	return matchAny(s.Exclude, rel)
+}
+
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// run calls fn for each action, on up to Concurrency connections at once.
+func (s *Syncer) run(actions []SyncAction, fn func(c *ServerConn, a SyncAction) error) error {
+	workers := s.Concurrency
+	if workers > len(actions) {
+		workers = len(actions)
+	}
+	if workers <= 1 || s.Dial == nil {
+		for _, a := range actions {
+			if err := fn(s.Conn, a); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	queue := make(chan SyncAction)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, err := s.Dial()
+			if err != nil {
+				errs[i] = err
+				for range queue {
+				}
+				return
+			}
+			defer c.Quit()
+			for a := range queue {
+				if errs[i] == nil {
+					errs[i] = fn(c, a)
+				}
+			}
+		}(i)
+	}
+	for _, a := range actions {
+		queue <- a
+	}
+	close(queue)
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// UploadDir mirrors the local directory to the remote directory, as Upload.
+func (s *Syncer) UploadDir(local, remote string) ([]SyncAction, error) {
+	return s.Upload(os.DirFS(local), remote)
+}
+
+// Upload mirrors the tree of fsys to the remote directory, and returns the
+// actions taken, or planned in dry-run mode. The remote directories are
+// created as needed.
+func (s *Syncer) Upload(fsys fs.FS, remote string) ([]SyncAction, error) {
+	actions, err := s.planUpload(fsys, remote)
+	if err != nil || s.DryRun {
+		return actions, err
+	}
+
+	var transfers []SyncAction
+	for _, a := range actions {
+		name := path.Join(remote, a.Path)
+		switch a.Op {
+		case SyncMkdir:
+			err = s.Conn.MakeDirAll(name)
+		case SyncDelete:
+			err = s.Conn.RemoveAll(name)
+		case SyncUpload:
+			transfers = append(transfers, a)
+		}
+		if err != nil {
+			return actions, err
+		}
+	}
+
+	err = s.run(transfers, func(c *ServerConn, a SyncAction) error {
+		return upload(c, fsys, a.Path, path.Join(remote, a.Path), s.TempName)
+	})
+	return actions, err
+}
+
+// planUpload compares the trees and returns the actions to take.
+func (s *Syncer) planUpload(fsys fs.FS, remote string) ([]SyncAction, error) {
+	var actions []SyncAction
+	remoteFiles := make(map[string]fs.FileInfo)
+	remoteDirs := make(map[string]bool)
+
+	if _, err := s.Conn.Stat(remote); errors.Is(err, fs.ErrNotExist) {
+		actions = append(actions, SyncAction{Op: SyncMkdir, Path: "."})
+	} else if err != nil {
+		return nil, err
+	} else {
+		err = s.Conn.Walk(remote, func(name string, entry *FTPListData, err error) error {
+			if err != nil {
+				return err
+			}
+			rel := strings.TrimPrefix(strings.TrimPrefix(name, remote), "/")
+			switch {
+			case rel == "":
+			case entry.isDir():
+				if s.excluded(rel) {
+					return fs.SkipDir
+				}
+				remoteDirs[rel] = true
+			case s.selected(rel):
+				remoteFiles[rel] = &fileInfo{entry}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	localFiles := make(map[string]bool)
+	localDirs := make(map[string]bool)
+	err := fs.WalkDir(fsys, ".", func(rel string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if d.IsDir() {
+			if s.excluded(rel) {
+				return fs.SkipDir
+			}
+			localDirs[rel] = true
+			if !remoteDirs[rel] {
+				actions = append(actions, SyncAction{Op: SyncMkdir, Path: rel})
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !s.selected(rel) {
+			return nil
+		}
+		localFiles[rel] = true
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var dst fs.FileInfo
+		if info, ok := remoteFiles[rel]; ok {
+			dst = info
+		}
+		changed, err := s.changed(fi, dst, func(algo string) ([]byte, error) {
+			f, err := fsys.Open(rel)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			return checksum(algo, f)
+		}, path.Join(remote, rel))
+		if err != nil {
+			return err
+		}
+		if changed {
+			actions = append(actions, SyncAction{Op: SyncUpload, Path: rel, Size: fi.Size()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Delete {
+		var extras []string
+		for rel := range remoteFiles {
+			if !localFiles[rel] {
+				extras = append(extras, rel)
+			}
+		}
+		for rel := range remoteDirs {
+			if !localDirs[rel] {
+				extras = append(extras, rel)
+			}
+		}
+		sort.Strings(extras)
+
+		// the contents of a deleted directory go along with it
+		deleted := make(map[string]bool)
+		for _, rel := range extras {
+			if !underAny(deleted, rel) {
+				actions = append(actions, SyncAction{Op: SyncDelete, Path: rel})
+			}
+			deleted[rel] = true
+		}
+	}
+	return actions, nil
+}
+
+// underAny reports whether one of the parents of rel is in dirs.
+func underAny(dirs map[string]bool, rel string) bool {
+	for p := path.Dir(rel); p != "."; p = path.Dir(p) {
+		if dirs[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// upload copies the file name of fsys to the server, atomically if
+// tempName is set.
+func upload(c *ServerConn, fsys fs.FS, name, remote string, tempName TempNameFunc) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if tempName != nil {
+		err = c.StorAtomic(remote, f, tempName)
+	} else {
+		err = c.Stor(remote, f)
+	}
+	if err != nil {
+		return &fs.PathError{Op: "stor", Path: remote, Err: err}
+	}
+	return nil
+}
+
+// download copies a remote file to local through a temporary file, and
+// sets its modification time to the remote one.
+func download(c *ServerConn, remote, local string, info fs.FileInfo) error {
+	dir, base := filepath.Split(local)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	r, err := c.Retr(remote)
+	if err != nil {
+		tmp.Close()
+		return &fs.PathError{Op: "retr", Path: remote, Err: err}
+	}
+	_, err = io.Copy(tmp, r)
+	if err2 := r.Close(); err == nil {
+		err = err2
+	}
+	if err2 := tmp.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return &fs.PathError{Op: "retr", Path: remote, Err: err}
+	}
+
+	if mtime := info.ModTime(); !mtime.IsZero() {
+		if err = os.Chtimes(tmp.Name(), mtime, mtime); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), local)
+}
+
+// Checksum returns the checksum of a remote file and the name of its
+// algorithm, such as "SHA-256" or "MD5". The HASH command is used when the
+// server advertises it, else XMD5.
+func (c *ServerConn) Checksum(path string) (algo string, sum []byte, err error) {
+	if c.hasFeature("HASH") {
+		// 213 SHA-256 0-49 169cd22282da7f147cb491e559e9dd filename
+		_, msg, err := c.cmd(StatusFile, "HASH %s", path)
+		if err != nil {
+			return "", nil, err
+		}
+		fields := strings.Fields(msg)
+		if len(fields) < 3 {
+			return "", nil, fmt.Errorf("invalid HASH response: %s", msg)
+		}
+		sum, err = hex.DecodeString(fields[2])
+		return fields[0], sum, err
+	}
+
+	code, msg, err := c.cmd(-1, "XMD5 %s", path)
+	if err != nil {
+		return "", nil, err
+	}
+	if code/100 != 2 {
+		return "", nil, &textproto.Error{Code: code, Msg: msg}
+	}
+	fields := strings.Fields(msg)
+	if len(fields) == 0 {
+		return "", nil, fmt.Errorf("invalid XMD5 response: %s", msg)
+	}
+	sum, err = hex.DecodeString(fields[len(fields)-1])
+	return "MD5", sum, err
+}
+
+var checksumAlgos = map[string]func() hash.Hash{
+	"MD5":     md5.New,
+	"SHA-1":   sha1.New,
+	"SHA-256": sha256.New,
+	"SHA-512": sha512.New,
+}
+
+// checksum computes the checksum of r with the named algorithm.
+func checksum(algo string, r io.Reader) ([]byte, error) {
+	newHash, ok := checksumAlgos[strings.ToUpper(algo)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported checksum algorithm %s", algo)
+	}
+	h := newHash()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,223 @@
+package ftp
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string, mtime time.Time) {
+	for name, data := range files {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSyncerDownload(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"/pub/same.txt":       "same",
+		"/pub/changed.txt":    "new content",
+		"/pub/new.txt":        "new",
+		"/pub/sub/deep.txt":   "deep",
+		"/pub/skip.tmp":       "skipped",
+		"/pub/cache/data.txt": "cached",
+		"/other/x.txt":        "x",
+	})
+	// links are left alone, on both sides
+	s.symlink("/pub/latest", "/other")
+	local := t.TempDir()
+	writeFiles(t, local, map[string]string{
+		"same.txt":        "same",
+		"changed.txt":     "old",
+		"extra.txt":       "extra",
+		"gone/x.txt":      "x",
+		"local.tmp":       "kept",
+		"latest/mine.txt": "mine",
+	}, testMtime)
+
+	syncer := &Syncer{
+		Conn:        s.conn(),
+		Dial:        s.dial,
+		Delete:      true,
+		Exclude:     []string{"*.tmp", "cache"},
+		DryRun:      true,
+		Concurrency: 2,
+	}
+	want := []SyncAction{
+		{Op: SyncDownload, Path: "changed.txt", Size: 11},
+		{Op: SyncDownload, Path: "new.txt", Size: 3},
+		{Op: SyncMkdir, Path: "sub"},
+		{Op: SyncDownload, Path: "sub/deep.txt", Size: 4},
+		{Op: SyncDelete, Path: "extra.txt"},
+		{Op: SyncDelete, Path: "gone"},
+	}
+	actions, err := syncer.Download("/pub", local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actions, want) {
+		t.Errorf("planned %v, want %v", actions, want)
+	}
+	if _, err = os.Stat(filepath.Join(local, "new.txt")); !os.IsNotExist(err) {
+		t.Error("dry run downloaded new.txt")
+	}
+
+	syncer.DryRun = false
+	if _, err = syncer.Download("/pub", local); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		"same.txt": "same", "changed.txt": "new content", "new.txt": "new", "sub/deep.txt": "deep", "local.tmp": "kept",
+		"latest/mine.txt": "mine",
+	} {
+		got, err := os.ReadFile(filepath.Join(local, filepath.FromSlash(name)))
+		if err != nil || string(got) != data {
+			t.Errorf("%s = '%s', %v; want '%s'", name, got, err, data)
+		}
+	}
+	for _, name := range []string{"extra.txt", "gone", "skip.tmp", "cache"} {
+		if _, err = os.Stat(filepath.Join(local, name)); !os.IsNotExist(err) {
+			t.Errorf("%s exists after the sync", name)
+		}
+	}
+
+	actions, err = syncer.Download("/pub", local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 0 {
+		t.Errorf("second sync took actions %v", actions)
+	}
+
+	// a change of content which keeps the size and time is only seen by
+	// the checksums
+	writeFiles(t, local, map[string]string{"same.txt": "SAME"}, testMtime)
+	syncer.Compare = CompareChecksum
+	actions, err = syncer.Download("/pub", local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []SyncAction{{Op: SyncDownload, Path: "same.txt", Size: 4}}
+	if !reflect.DeepEqual(actions, want) {
+		t.Errorf("checksum sync took actions %v, want %v", actions, want)
+	}
+}
+
+func TestSyncerUpload(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"/dist/same.txt":      "same",
+		"/dist/changed.txt":   "old",
+		"/dist/old/stale.txt": "stale",
+		"/dist/old/x/y.txt":   "y",
+		"/dist/extra.txt":     "extra",
+		"/dist/keep.tmp":      "kept",
+		"/data/precious.txt":  "precious",
+	})
+	// a link to a directory is deleted as a file, not emptied
+	s.symlink("/dist/shared", "/data")
+	local := t.TempDir()
+	writeFiles(t, local, map[string]string{
+		"same.txt":         "same",
+		"changed.txt":      "new content",
+		"new/file.txt":     "new",
+		"new/sub/deep.txt": "deep",
+		"skip.tmp":         "skipped",
+	}, testMtime.Add(-time.Hour))
+
+	syncer := &Syncer{
+		Conn:    s.conn(),
+		Dial:    s.dial,
+		Delete:  true,
+		Exclude: []string{"*.tmp"},
+		DryRun:  true,
+	}
+	want := []SyncAction{
+		{Op: SyncUpload, Path: "changed.txt", Size: 11},
+		{Op: SyncMkdir, Path: "new"},
+		{Op: SyncUpload, Path: "new/file.txt", Size: 3},
+		{Op: SyncMkdir, Path: "new/sub"},
+		{Op: SyncUpload, Path: "new/sub/deep.txt", Size: 4},
+		{Op: SyncDelete, Path: "extra.txt"},
+		{Op: SyncDelete, Path: "old"},
+		{Op: SyncDelete, Path: "shared"},
+	}
+	actions, err := syncer.UploadDir(local, "/dist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actions, want) {
+		t.Errorf("planned %v, want %v", actions, want)
+	}
+
+	syncer.DryRun = false
+	syncer.Concurrency = 2
+	if _, err = syncer.UploadDir(local, "/dist"); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		"/dist/same.txt": "same", "/dist/changed.txt": "new content", "/dist/new/file.txt": "new",
+		"/dist/new/sub/deep.txt": "deep", "/dist/keep.tmp": "kept",
+	} {
+		if f := s.file(name); f == nil || string(f.data) != data {
+			t.Errorf("%s was not uploaded", name)
+		}
+	}
+	for _, name := range []string{"/dist/extra.txt", "/dist/old", "/dist/old/x/y.txt", "/dist/skip.tmp", "/dist/shared"} {
+		if s.file(name) != nil {
+			t.Errorf("%s exists after the sync", name)
+		}
+	}
+	if f := s.file("/data/precious.txt"); f == nil {
+		t.Error("the target of /dist/shared was deleted")
+	}
+
+	actions, err = syncer.UploadDir(local, "/dist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 0 {
+		t.Errorf("second sync took actions %v", actions)
+	}
+
+	// a missing remote root is created
+	actions, err = syncer.UploadDir(local, "/fresh/dist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) == 0 || actions[0] != (SyncAction{Op: SyncMkdir, Path: "."}) {
+		t.Errorf("upload to a new root took actions %v", actions)
+	}
+	if f := s.file("/fresh/dist/new/sub/deep.txt"); f == nil {
+		t.Error("upload to a new root did not create the files")
+	}
+}
+
+func TestSyncerDownloadAborted(t *testing.T) {
+	s := newTestServer(t, map[string]string{"/pub/a.txt": "a", "/pub/b.txt": "b"})
+	// the listing of /pub is cut short after a.txt
+	s.lists = map[string]string{"/pub": unixLine("a.txt", s.file("/pub/a.txt"))}
+	s.aborts = map[string]int{"/pub": StatusTransfertAborted}
+	local := t.TempDir()
+	writeFiles(t, local, map[string]string{"a.txt": "a", "b.txt": "b"}, testMtime)
+
+	// a listing cut short must not be taken for missing remote files
+	syncer := &Syncer{Conn: s.conn(), Delete: true}
+	if _, err := syncer.Download("/pub", local); err == nil {
+		t.Error("Download after an aborted listing succeeded")
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if _, err := os.Stat(filepath.Join(local, name)); err != nil {
+			t.Errorf("%s was deleted: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package ftp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+SetTrace makes the connection write a transcript of the protocol to w, nil
+to stop it. Each line holds a timestamp, a direction and the text:
+
+	2023-04-27T21:09:03.125+02:00 > RETR README
+	2023-04-27T21:09:03.127+02:00 < 150 Opening BINARY mode data connection
+	2023-04-27T21:09:03.127+02:00 * data open 192.0.2.1:50123
+
+">" marks the commands sent, "<" the reply lines received, and "*" the
+events of the data connections. The arguments of PASS and ACCT are
+replaced by "****". Use ConnectTrace to also record the greeting of the
+server.
+*/
+func (c *ServerConn) SetTrace(w io.Writer) {
+	c.trace.mu.Lock()
+	c.trace.w = w
+	c.trace.mu.Unlock()
+}
+
+// tracer writes the lines of a transcript.
+type tracer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (t *tracer) enabled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.w != nil
+}
+
+func (t *tracer) line(dir byte, text string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.w == nil {
+		return
+	}
+	fmt.Fprintf(t.w, "%s %c %s\n", time.Now().Format("2006-01-02T15:04:05.000Z07:00"), dir, text)
+}
+
+func (t *tracer) event(format string, args ...interface{}) {
+	t.line('*', fmt.Sprintf(format, args...))
+}
+
+// traceConn records the lines going through the control connection.
+type traceConn struct {
+	net.Conn
+	t    *tracer
+	rbuf []byte
+	wbuf []byte
+}
+
+func (tc *traceConn) Read(buf []byte) (int, error) {
+	n, err := tc.Conn.Read(buf)
+	tc.rbuf = tc.record('<', append(tc.rbuf, buf[:n]...))
+	return n, err
+}
+
+func (tc *traceConn) Write(buf []byte) (int, error) {
+	n, err := tc.Conn.Write(buf)
+	tc.wbuf = tc.record('>', append(tc.wbuf, buf[:n]...))
+	return n, err
+}
+
+// record traces the complete lines of pending and returns the rest.
+func (tc *traceConn) record(dir byte, pending []byte) []byte {
+	for {
+		i := bytes.IndexByte(pending, '\n')
+		if i < 0 {
+			return pending
+		}
+		line := strings.TrimRight(string(pending[:i]), "\r")
+		if dir == '>' {
+			line = redact(line)
+		}
+		tc.t.line(dir, line)
+		pending = pending[i+1:]
+	}
+}
+
+// redact hides the arguments of the commands which carry credentials.
+func redact(line string) string {
+	verb := strings.ToUpper(line)
+	if strings.HasPrefix(verb, "PASS ") || strings.HasPrefix(verb, "ACCT ") {
+		return line[:5] + "****"
+	}
+	return line
+}
+
+// traceDataConn records the end of a data connection.
+type traceDataConn struct {
+	net.Conn
+	t     *tracer
+	n     int64
+	close sync.Once
+}
+
+func (tc *traceDataConn) Read(buf []byte) (int, error) {
+	n, err := tc.Conn.Read(buf)
+	tc.n += int64(n)
+	return n, err
+}
+
+func (tc *traceDataConn) Write(buf []byte) (int, error) {
+	n, err := tc.Conn.Write(buf)
+	tc.n += int64(n)
+	return n, err
+}
+
+func (tc *traceDataConn) Close() error {
+	err := tc.Conn.Close()
+	tc.close.Do(func() {
+		tc.t.event("data close %s, %d bytes", tc.RemoteAddr(), tc.n)
+	})
+	return err
+}
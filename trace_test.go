@@ -0,0 +1,58 @@
+package ftp
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	s := newTestServer(t, map[string]string{"/file": "Just some text"})
+
+	var buf bytes.Buffer
+	c, err := ConnectTrace(s.addr(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	if err = c.Login("anonymous", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.Retr("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, r)
+	r.Close()
+
+	trace := buf.String()
+	if strings.Contains(trace, "secret") {
+		t.Error("the password is in the trace")
+	}
+	for _, want := range []string{
+		`< 220 test server ready`,
+		`> USER anonymous`,
+		`> PASS \*\*\*\*`,
+		`< 230 logged in`,
+		`> RETR /file`,
+		`\* data open 127\.0\.0\.1:\d+`,
+		`\* data close 127\.0\.0\.1:\d+, 14 bytes`,
+		`< 226 transfer complete`,
+	} {
+		re := regexp.MustCompile(`(?m)^\d{4}-\d\d-\d\dT[\d:.]+\S* ` + want + `$`)
+		if !re.MatchString(trace) {
+			t.Errorf("the trace has no line %s:\n%s", want, trace)
+		}
+	}
+
+	c.SetTrace(nil)
+	buf.Reset()
+	if err = c.NoOp(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("traced after SetTrace(nil): %s", buf.String())
+	}
+}
@@ -0,0 +1,142 @@
+package ftp
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+/*
+WalkFunc is the type of the function called by Walk to visit each file or
+directory, in the spirit of fs.WalkDirFunc.
+
+The path argument is the root passed to Walk joined with the names of the
+entries leading to the file. The entry is the parsed listing line of the
+file; for the root it is the entry given by Stat.
+
+If the root cannot be found, the function is called once for it with a
+nil entry and the error. If listing a directory fails, the function is
+called a second time for that directory with the error. Returning
+fs.SkipDir from a directory skips its contents; returning it from a file
+skips the remaining files of the directory. Returning fs.SkipAll stops the
+walk. Any other error stops the walk and is returned by Walk.
+*/
+type WalkFunc func(path string, entry *FTPListData, err error) error
+
+// Walk walks the remote tree rooted at root, calling fn for each file or
+// directory in the tree, including root, in lexical order of the names.
+// Directories are listed with MLSD when the server supports it, else with
+// LIST. Symbolic links are reported but not followed, except for a root
+// which leads to a directory. If root is a file, fn is only called for it.
+func (c *ServerConn) Walk(root string, fn WalkFunc) error {
+	w := &walker{c: c, fn: fn}
+	return w.walkRoot(root)
+}
+
+// WalkLinks is like Walk, but it also descends into symbolic links which
+// point to directories. A link is not followed if its target is being
+// walked already, or has been walked before, so cycles are not entered.
+func (c *ServerConn) WalkLinks(root string, fn WalkFunc) error {
+	w := &walker{c: c, fn: fn, followLinks: true, visited: make(map[string]bool)}
+	return w.walkRoot(root)
+}
+
+type walker struct {
+	c           *ServerConn
+	fn          WalkFunc
+	followLinks bool
+	visited     map[string]bool // real paths of the walked directories
+}
+
+func (w *walker) walkRoot(root string) error {
+	fi, err := w.c.Stat(root)
+	if err != nil {
+		err = w.fn(root, nil, err)
+	} else {
+		entry := fi.Sys().(*FTPListData)
+		isDir := entry.isDir()
+		if entry.isLink() {
+			isDir, err = w.c.isDir(root)
+		}
+		if err == nil {
+			err = w.fn(root, entry, nil)
+		}
+		if err == nil && isDir {
+			err = w.walkDir(root, root, entry)
+		}
+	}
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkDir walks the contents of the directory named by dir, whose real
+// path, with the followed links resolved, is real.
+func (w *walker) walkDir(dir, real string, entry *FTPListData) error {
+	if w.visited != nil {
+		w.visited[real] = true
+	}
+
+	entries, err := w.c.readDir(dir)
+	if err != nil {
+		err = w.fn(dir, entry, err)
+		if err == fs.SkipDir {
+			return nil
+		}
+		return err
+	}
+	// servers list in their own order
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	for _, entry := range entries {
+		name := path.Join(dir, entry.Name)
+		isLink := entry.LinkDest != ""
+
+		err = w.fn(name, entry, nil)
+		if err == fs.SkipDir {
+			if entry.isDir() {
+				continue
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if isLink {
+			if !w.followLinks {
+				continue
+			}
+			target := entry.LinkDest
+			if !path.IsAbs(target) {
+				target = path.Join(real, target)
+			}
+			if w.loops(real, target) {
+				continue
+			}
+			var isDir bool
+			if isDir, err = w.c.isDir(target); err != nil {
+				return err
+			} else if !isDir {
+				continue
+			}
+			err = w.walkDir(name, target, entry)
+		} else if entry.isDir() {
+			err = w.walkDir(name, path.Join(real, entry.Name), entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loops reports whether following a link from the directory real to target
+// would enter a directory which is being walked or was walked already.
+func (w *walker) loops(real, target string) bool {
+	if w.visited[target] {
+		return true
+	}
+	return target == "/" || strings.HasPrefix(real+"/", target+"/")
+}
@@ -0,0 +1,129 @@
+package ftp
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+var walkFiles = map[string]string{
+	"/root/a.txt":       "a",
+	"/root/b/c.txt":     "c",
+	"/root/b/d/e.txt":   "e",
+	"/root/f/g.txt":     "g",
+	"/other/h/i.txt":    "i",
+	"/root/zzz/end.txt": "end",
+}
+
+func walkPaths(t *testing.T, c *ServerConn, follow bool, skip string) []string {
+	var paths []string
+	fn := func(path string, entry *FTPListData, err error) error {
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		paths = append(paths, path)
+		if path == skip {
+			return fs.SkipDir
+		}
+		return nil
+	}
+
+	var err error
+	if follow {
+		err = c.WalkLinks("/root", fn)
+	} else {
+		err = c.Walk("/root", fn)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestWalk(t *testing.T) {
+	for _, mlsd := range []bool{false, true} {
+		s := newTestServer(t, walkFiles)
+		s.mlsd = mlsd
+		s.symlink("/root/loop", "..")
+		s.symlink("/root/other", "../other")
+		c := s.conn()
+
+		want := []string{"/root", "/root/a.txt", "/root/b", "/root/b/c.txt", "/root/b/d", "/root/b/d/e.txt",
+			"/root/f", "/root/f/g.txt", "/root/loop", "/root/other", "/root/zzz", "/root/zzz/end.txt"}
+		if got := walkPaths(t, c, false, ""); !reflect.DeepEqual(got, want) {
+			t.Errorf("mlsd=%v: Walk visited %v, want %v", mlsd, got, want)
+		}
+
+		want = []string{"/root", "/root/a.txt", "/root/b", "/root/f", "/root/f/g.txt", "/root/loop",
+			"/root/other", "/root/other/h", "/root/other/h/i.txt", "/root/zzz", "/root/zzz/end.txt"}
+		if got := walkPaths(t, c, true, "/root/b"); !reflect.DeepEqual(got, want) {
+			t.Errorf("mlsd=%v: WalkLinks visited %v, want %v", mlsd, got, want)
+		}
+	}
+}
+
+func TestWalkFile(t *testing.T) {
+	for _, mlsd := range []bool{false, true} {
+		s := newTestServer(t, walkFiles)
+		s.mlsd = mlsd
+		s.symlink("/link", "/root/b")
+		c := s.conn()
+
+		var paths []string
+		err := c.Walk("/root/a.txt", func(path string, entry *FTPListData, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.Name != "a.txt" || entry.Size != 1 {
+				t.Errorf("mlsd=%v: entry of the root = %+v", mlsd, entry)
+			}
+			paths = append(paths, path)
+			return nil
+		})
+		if err != nil || !reflect.DeepEqual(paths, []string{"/root/a.txt"}) {
+			t.Errorf("mlsd=%v: Walk of a file visited %v, %v", mlsd, paths, err)
+		}
+
+		// a root link to a directory is walked through
+		paths = nil
+		err = c.Walk("/link", func(path string, entry *FTPListData, err error) error {
+			paths = append(paths, path)
+			return err
+		})
+		want := []string{"/link", "/link/c.txt", "/link/d", "/link/d/e.txt"}
+		if err != nil || !reflect.DeepEqual(paths, want) {
+			t.Errorf("mlsd=%v: Walk of a link visited %v, %v; want %v", mlsd, paths, err, want)
+		}
+
+		var gotErr error
+		err = c.Walk("/missing", func(path string, entry *FTPListData, err error) error {
+			if entry != nil {
+				t.Errorf("mlsd=%v: entry of a missing root = %+v", mlsd, entry)
+			}
+			gotErr = err
+			return err
+		})
+		if !errors.Is(err, fs.ErrNotExist) || !errors.Is(gotErr, fs.ErrNotExist) {
+			t.Errorf("mlsd=%v: Walk of a missing root = %v", mlsd, err)
+		}
+	}
+}
+
+func TestWalkOrder(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.mkdirAll("/w")
+	s.lists = map[string]string{"/w": unixLine("b.txt", &testFile{mtime: testMtime}) +
+		unixLine("c.txt", &testFile{mtime: testMtime}) + unixLine("a.txt", &testFile{mtime: testMtime})}
+	c := s.conn()
+
+	var paths []string
+	err := c.Walk("/w", func(path string, entry *FTPListData, err error) error {
+		paths = append(paths, path)
+		return err
+	})
+	want := []string{"/w", "/w/a.txt", "/w/b.txt", "/w/c.txt"}
+	if err != nil || !reflect.DeepEqual(paths, want) {
+		t.Errorf("Walk visited %v, %v; want %v", paths, err, want)
+	}
+}